@@ -3,168 +3,241 @@ package apu
 import (
 	"math"
 
-	"github.com/hajimehoshi/ebiten/v2/audio"
+	"github.com/pishiko/gones/cartridge"
 )
 
+//cpuClock NTSCのCPUクロック(Hz)
+const cpuClock = 1789773
+
+//SampleRate 出力するPCMのサンプリング周波数の既定値
+const SampleRate = 44100
+
 var lengthTable = [2][16]int{
 	{0x0a, 0x14, 0x28, 0x50, 0xa0, 0x3c, 0x0e, 0x1a, 0x0c, 0x18, 0x30, 0x60, 0xc0, 0x48, 0x10, 0x20},
 	{0xfe, 0x02, 0x04, 0x06, 0x08, 0x0a, 0x0c, 0x0e, 0x10, 0x12, 0x14, 0x16, 0x18, 0x1a, 0x1c, 0x1e},
 }
 
 type APU struct {
-	register       [0x16]uint8
-	squarePlayers  [2]*audio.Player
-	squareStreams  [2]*stream
-	trianglePlayer *audio.Player
-	triangleStream *stream
-	cycle          int
-	volumeRate     float64
-}
-
-func NewAPU(volume float64) *APU {
-	apu := &APU{volumeRate: volume}
-	apu.Init()
+	pulse    [2]*pulse
+	triangle *triangle
+	noise    *noise
+	dmc      *dmc
+	cycle    int
+	//フレームシーケンサ
+	frameCycle int
+	isFiveStep bool
+	//frameReset は $4017 書き込みからシーケンサがリセットされるまでのサイクル
+	frameReset int
+	//isIRQInhibit は $4017 bit6．立っているとフレームIRQを出さない
+	isIRQInhibit bool
+	isFrameIRQ   bool
+	//出力段
+	resampler *resampler
+	filters   []*filter
+	samples   []int16
+}
+
+//NewAPU はDMCのサンプルを mapper から読むAPUを作る
+func NewAPU(mapper cartridge.Mapper) *APU {
+	apu := &APU{}
+	apu.pulse[0] = &pulse{isFirst: true}
+	apu.pulse[1] = &pulse{}
+	apu.triangle = &triangle{}
+	apu.noise = newNoise()
+	apu.dmc = newDMC(mapper.ReadCPU)
+	apu.SetSampleRate(SampleRate)
 	return apu
 }
 
-func (a *APU) Init() {
+//SetSampleRate は出力するPCMのサンプリング周波数を変える
+func (a *APU) SetSampleRate(rate int) {
+	a.resampler = newResampler(rate)
+	//実機の出力段: 90Hz と 440Hz のハイパス，14kHz のローパス
+	a.filters = []*filter{
+		highPass(rate, 90),
+		highPass(rate, 440),
+		lowPass(rate, 14000),
+	}
+	a.samples = nil
+}
 
-	var audioContext = audio.NewContext(sampleRate)
-	a.squareStreams[0] = NewStream(squareWave2, 800*a.volumeRate)
-	a.squarePlayers[0], _ = audio.NewPlayer(audioContext, a.squareStreams[0])
-	a.squarePlayers[0].Play()
-	a.squareStreams[1] = NewStream(squareWave2, 800*a.volumeRate)
-	a.squarePlayers[1], _ = audio.NewPlayer(audioContext, a.squareStreams[1])
-	a.squarePlayers[1].Play()
+//Samples は溜まったPCM(モノラル，SetSampleRate の周波数)を返して空にする
+func (a *APU) Samples() []int16 {
+	s := a.samples
+	a.samples = nil
+	return s
+}
 
-	a.triangleStream = NewStream(triangleWave, 2000*a.volumeRate)
-	a.trianglePlayer, _ = audio.NewPlayer(audioContext, a.triangleStream)
-	a.trianglePlayer.Play()
-	return
+//Stall はDMCの読み出しでCPUが止まるべきサイクル数を返して0にする
+func (a *APU) Stall() int {
+	s := a.dmc.stall
+	a.dmc.stall = 0
+	return s
+}
 
+//IRQ はフレームシーケンサかDMCがIRQを出していればtrue
+func (a *APU) IRQ() bool {
+	return a.isFrameIRQ || a.dmc.isIRQ
 }
 
+//Run は cycle CPUサイクル分APUを進める
 func (a *APU) Run(cycle int) {
-	a.cycle += cycle
-	if a.cycle >= 1200 {
-		a.cycle -= 1200
-		a.squareStreams[0].Time = math.Max(0, a.squareStreams[0].Time-1)
-		a.squareStreams[1].Time = math.Max(0, a.squareStreams[1].Time-1)
-		a.triangleStream.Time = math.Max(0, a.triangleStream.Time-1)
-		sq1bytes := a.register[0x0001]
-		if sq1bytes&0x80 != 0x00 {
-			a.squareStreams[0].sweepCount -= 1
-			if a.squareStreams[0].sweepCount < 1 {
-				a.squareStreams[0].sweepCount = 0 * (int((sq1bytes&0x70)>>4) + 1)
-				n := 1
-				if (sq1bytes & 0x08) != 0 {
-					n = -1
-				}
-				s := sq1bytes & 0x07
-				f := (int(a.register[0x0003]&0x03) << 8) + int(a.register[0x0004])
-				f = f + n*(f>>s)
-				a.squareStreams[0].Frequency = 1790000 / int((f<<5)+1)
+	for i := 0; i < cycle; i++ {
+		a.step()
+	}
+	a.resampler.read(a.output)
+}
+
+//output はリサンプルされた値に出力段のフィルタを掛けて溜める
+func (a *APU) output(v float64) {
+	for _, f := range a.filters {
+		v = f.step(v)
+	}
+	v = math.Max(-1, math.Min(1, v))
+	a.samples = append(a.samples, int16(v*math.MaxInt16))
+}
+
+func (a *APU) step() {
+	a.cycle++
+	a.triangle.stepTimer()
+	a.noise.stepTimer()
+	a.dmc.stepTimer()
+	if a.cycle%2 == 0 {
+		a.pulse[0].stepTimer()
+		a.pulse[1].stepTimer()
+	}
+	a.stepFrameCounter()
+	a.resampler.add(a.mix())
+}
+
+//stepFrameCounter は4/5ステップのフレームシーケンサを進める
+func (a *APU) stepFrameCounter() {
+	if a.frameReset > 0 {
+		a.frameReset--
+		if a.frameReset == 0 {
+			a.frameCycle = 0
+			if a.isFiveStep {
+				a.quarterFrame()
+				a.halfFrame()
 			}
 		}
-		sq2bytes := a.register[0x0005]
-		if sq2bytes&0x80 != 0x00 {
-			a.squareStreams[1].sweepCount -= 1
-			if a.squareStreams[1].sweepCount < 1 {
-				a.squareStreams[1].sweepCount = 10000 * (int((sq2bytes&0x70)>>4) + 1)
-				n := 1
-				if (sq2bytes & 0x08) != 0 {
-					n = -1
-				}
-				s := sq2bytes & 0x07
-				f := a.squareStreams[1].Frequency
-				f = f + n*(f>>s)
-				if f > 44100 {
-					f = 44100
-				}
-				a.squareStreams[1].Frequency = f
-			}
+	}
+	a.frameCycle++
+	switch a.frameCycle {
+	case 7457, 22371:
+		a.quarterFrame()
+	case 14913:
+		a.quarterFrame()
+		a.halfFrame()
+	case 29828:
+		a.setFrameIRQ()
+	case 29829:
+		if !a.isFiveStep {
+			a.setFrameIRQ()
+			a.quarterFrame()
+			a.halfFrame()
 		}
+	case 29830:
+		if !a.isFiveStep {
+			a.setFrameIRQ()
+			a.frameCycle = 0
+		}
+	case 37281:
+		a.quarterFrame()
+		a.halfFrame()
+	case 37282:
+		a.frameCycle = 0
 	}
+}
+
+//setFrameIRQ 4ステップモードの最後の3サイクルでフレームIRQを立てる
+func (a *APU) setFrameIRQ() {
+	if !a.isFiveStep && !a.isIRQInhibit {
+		a.isFrameIRQ = true
+	}
+}
 
+//quarterFrame エンベロープと線形カウンタ
+func (a *APU) quarterFrame() {
+	a.pulse[0].envelope.clock()
+	a.pulse[1].envelope.clock()
+	a.noise.envelope.clock()
+	a.triangle.clockLinear()
+}
+
+//halfFrame 長さカウンタとスイープ
+func (a *APU) halfFrame() {
+	a.pulse[0].clockLength()
+	a.pulse[1].clockLength()
+	a.triangle.clockLength()
+	a.noise.clockLength()
+	a.pulse[0].clockSweep()
+	a.pulse[1].clockSweep()
 }
 
 func (a *APU) Write(addr uint16, data uint8) {
-	a.register[addr-0x4000] = data
-	switch addr {
-	//SQUARE 1
-	case 0x4000:
-		duty := (data & 0xc0) >> 6
-		switch duty {
-		case 0x00:
-			a.squareStreams[0].function = squareWave0
-		case 0x01:
-			a.squareStreams[0].function = squareWave1
-		case 0x02:
-			a.squareStreams[0].function = squareWave2
-		case 0x03:
-			a.squareStreams[0].function = squareWave3
-		}
-	case 0x4002:
-		n := (uint32(a.register[0x0003]&0x03) << 8) + uint32(data)
-		a.squareStreams[0].Frequency = 1790000 / int((n<<5)+1)
-	case 0x4003:
-		n := (uint32(data&0x03) << 8) + uint32(a.register[0x0002])
-		a.squareStreams[0].Frequency = 1790000 / int((n<<5)+1)
-
-		bit3 := (data & 0x08) >> 3
-		index := (data & 0xf0) >> 4
-		a.squareStreams[0].Time = float64(lengthTable[bit3][index])
-	//SQUARE 2
-	case 0x4004:
-		duty := (data & 0xc0) >> 6
-		switch duty {
-		case 0x00:
-			a.squareStreams[1].function = squareWave0
-		case 0x01:
-			a.squareStreams[1].function = squareWave1
-		case 0x02:
-			a.squareStreams[1].function = squareWave2
-		case 0x03:
-			a.squareStreams[1].function = squareWave3
-		}
-	case 0x4006:
-		n := (uint32(a.register[0x0007]&0x03) << 8) + uint32(data)
-		a.squareStreams[1].Frequency = 1790000 / int((n<<5)+1)
-	case 0x4007:
-		n := (uint32(data&0x03) << 8) + uint32(a.register[0x0006])
-		a.squareStreams[1].Frequency = 1790000 / int((n<<5)+1)
-
-		bit3 := (data & 0x08) >> 3
-		index := (data & 0xf0) >> 4
-		a.squareStreams[1].Time = float64(lengthTable[bit3][index])
-	//triangle
-	case 0x4008:
-
-	case 0x400a:
-		n := (uint32(a.register[0x000b]&0x03) << 8) + uint32(data)
-		a.triangleStream.Frequency = 1790000 / int((n<<6)+1)
-	case 0x400b:
-		n := (uint32(data&0x03) << 8) + uint32(a.register[0x000a])
-		a.triangleStream.Frequency = 1790000 / int((n<<6)+1)
-
-		bit3 := (data & 0x08) >> 3
-		index := (data & 0xf0) >> 4
-		a.triangleStream.Time = float64(lengthTable[bit3][index])
-	//noise
+	switch {
+	case addr < 0x4004:
+		a.pulse[0].write(addr-0x4000, data)
+	case addr < 0x4008:
+		a.pulse[1].write(addr-0x4004, data)
+	case addr < 0x400c:
+		a.triangle.write(addr-0x4008, data)
+	case addr < 0x4010:
+		a.noise.write(addr-0x400c, data)
+	case addr < 0x4014:
+		a.dmc.write(addr-0x4010, data)
 	//active flag
-	case 0x4015:
-		if data&0x01 != 0x00 {
-			a.squareStreams[0].IsActive = true
+	case addr == 0x4015:
+		a.pulse[0].setEnabled(data&0x01 != 0x00)
+		a.pulse[1].setEnabled(data&0x02 != 0x00)
+		a.triangle.setEnabled(data&0x04 != 0x00)
+		a.noise.setEnabled(data&0x08 != 0x00)
+		a.dmc.setEnabled(data&0x10 != 0x00)
+		a.dmc.isIRQ = false
+	//frame counter
+	case addr == 0x4017:
+		a.isFiveStep = data&0x80 != 0x00
+		a.isIRQInhibit = data&0x40 != 0x00
+		if a.isIRQInhibit {
+			a.isFrameIRQ = false
 		}
-		if data&0x02 != 0x00 {
-			a.squareStreams[1].IsActive = true
-		}
-		if data&0x04 != 0x00 {
-			a.triangleStream.IsActive = true
+		if a.cycle%2 == 0 {
+			a.frameReset = 3
+		} else {
+			a.frameReset = 4
 		}
 	}
 }
 
+//Read は $4015 のステータスを返す．他のレジスタは書き込み専用
 func (a *APU) Read(addr uint16) uint8 {
-	return a.register[addr-0x4000]
+	if addr != 0x4015 {
+		return 0x00
+	}
+	var status uint8
+	if a.pulse[0].length > 0 {
+		status |= 0x01
+	}
+	if a.pulse[1].length > 0 {
+		status |= 0x02
+	}
+	if a.triangle.length > 0 {
+		status |= 0x04
+	}
+	if a.noise.length > 0 {
+		status |= 0x08
+	}
+	if a.dmc.bytesRemaining > 0 {
+		status |= 0x10
+	}
+	if a.isFrameIRQ {
+		status |= 0x40
+	}
+	if a.dmc.isIRQ {
+		status |= 0x80
+	}
+	//読むとフレームIRQは下がる (DMCのIRQは残る)
+	a.isFrameIRQ = false
+	return status
 }
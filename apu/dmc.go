@@ -0,0 +1,138 @@
+package apu
+
+//dmcTable 周期(CPUサイクル)
+var dmcTable = [16]uint16{
+	428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54,
+}
+
+//dmcStallCycles はサンプル読み出しでCPUが止まるサイクル数
+const dmcStallCycles = 4
+
+//dmc デルタ変調チャンネル ($4010-$4013)
+type dmc struct {
+	//read はCPUのアドレス空間($8000-$FFFF)からサンプルを読む
+	read        func(addr uint16) uint8
+	isLoop      bool
+	isIRQOn     bool
+	isIRQ       bool
+	timer       uint16
+	timerPeriod uint16
+	level       uint8
+	//メモリリーダ
+	sampleAddr     uint16
+	sampleLength   uint16
+	currentAddr    uint16
+	bytesRemaining uint16
+	buffer         uint8
+	isBufferEmpty  bool
+	//出力ユニット
+	shift         uint8
+	bitsRemaining uint8
+	isSilence     bool
+	//stall は溜まったCPU停止サイクル
+	stall int
+}
+
+func newDMC(read func(addr uint16) uint8) *dmc {
+	return &dmc{
+		read:          read,
+		timerPeriod:   dmcTable[0],
+		isBufferEmpty: true,
+		bitsRemaining: 8,
+		isSilence:     true,
+	}
+}
+
+func (d *dmc) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		d.isIRQOn = data&0x80 != 0x00
+		if !d.isIRQOn {
+			d.isIRQ = false
+		}
+		d.isLoop = data&0x40 != 0x00
+		d.timerPeriod = dmcTable[data&0x0f]
+	case 1:
+		d.level = data & 0x7f
+	case 2:
+		d.sampleAddr = 0xc000 | uint16(data)<<6
+	case 3:
+		d.sampleLength = uint16(data)<<4 | 0x0001
+	}
+}
+
+func (d *dmc) setEnabled(isEnabled bool) {
+	if !isEnabled {
+		d.bytesRemaining = 0
+		return
+	}
+	if d.bytesRemaining == 0 {
+		d.restart()
+	}
+	d.fill()
+}
+
+func (d *dmc) restart() {
+	d.currentAddr = d.sampleAddr
+	d.bytesRemaining = d.sampleLength
+}
+
+//fill はバッファが空ならサンプルを1バイト読み，その間CPUを止める
+func (d *dmc) fill() {
+	if !d.isBufferEmpty || d.bytesRemaining == 0 {
+		return
+	}
+	d.stall += dmcStallCycles
+	d.buffer = d.read(d.currentAddr)
+	d.isBufferEmpty = false
+	if d.currentAddr == 0xffff {
+		d.currentAddr = 0x8000
+	} else {
+		d.currentAddr++
+	}
+	d.bytesRemaining--
+	if d.bytesRemaining > 0 {
+		return
+	}
+	if d.isLoop {
+		d.restart()
+	} else if d.isIRQOn {
+		d.isIRQ = true
+	}
+}
+
+//stepTimer はCPUサイクルごとに呼ぶ
+func (d *dmc) stepTimer() {
+	if d.timer > 0 {
+		d.timer--
+		return
+	}
+	d.timer = d.timerPeriod - 1
+	if !d.isSilence {
+		if d.shift&0x01 != 0x00 {
+			if d.level <= 125 {
+				d.level += 2
+			}
+		} else if d.level >= 2 {
+			d.level -= 2
+		}
+	}
+	d.shift >>= 1
+	d.bitsRemaining--
+	if d.bitsRemaining > 0 {
+		return
+	}
+	d.bitsRemaining = 8
+	if d.isBufferEmpty {
+		d.isSilence = true
+		return
+	}
+	d.isSilence = false
+	d.shift = d.buffer
+	d.isBufferEmpty = true
+	d.fill()
+}
+
+func (d *dmc) output() uint8 {
+	return d.level
+}
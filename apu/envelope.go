@@ -0,0 +1,48 @@
+package apu
+
+//envelope は矩形波とノイズの音量エンベロープ．1/4フレームごとに clock する
+type envelope struct {
+	isStart    bool
+	isLoop     bool
+	isConstant bool
+	volume     uint8
+	divider    uint8
+	decay      uint8
+}
+
+func (e *envelope) write(data uint8) {
+	e.isLoop = data&0x20 != 0x00
+	e.isConstant = data&0x10 != 0x00
+	e.volume = data & 0x0f
+}
+
+func (e *envelope) clock() {
+	if e.isStart {
+		e.isStart = false
+		e.decay = 15
+		e.divider = e.volume
+		return
+	}
+	if e.divider > 0 {
+		e.divider--
+		return
+	}
+	e.divider = e.volume
+	if e.decay > 0 {
+		e.decay--
+	} else if e.isLoop {
+		e.decay = 15
+	}
+}
+
+func (e *envelope) output() uint8 {
+	if e.isConstant {
+		return e.volume
+	}
+	return e.decay
+}
+
+//loadLength は $4003 などの上位5bitから長さカウンタの値を引く
+func loadLength(data uint8) uint8 {
+	return uint8(lengthTable[(data&0x08)>>3][(data&0xf0)>>4])
+}
@@ -0,0 +1,29 @@
+package apu
+
+import "math"
+
+//filter 1次のIIRフィルタ(双一次変換)．実機の出力段の特性を真似る
+type filter struct {
+	b0, b1, a1 float64
+	prevX      float64
+	prevY      float64
+}
+
+func highPass(rate int, cutoff float64) *filter {
+	c := float64(rate) / (math.Pi * cutoff)
+	a0 := 1 + c
+	return &filter{b0: c / a0, b1: -c / a0, a1: (1 - c) / a0}
+}
+
+func lowPass(rate int, cutoff float64) *filter {
+	c := float64(rate) / (math.Pi * cutoff)
+	a0 := 1 + c
+	return &filter{b0: 1 / a0, b1: 1 / a0, a1: (1 - c) / a0}
+}
+
+func (f *filter) step(x float64) float64 {
+	y := f.b0*x + f.b1*f.prevX - f.a1*f.prevY
+	f.prevX = x
+	f.prevY = y
+	return y
+}
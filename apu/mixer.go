@@ -0,0 +1,23 @@
+package apu
+
+//pulseTable, tndTable は実機の非線形ミキサーの出力 (0.0-1.0)
+var (
+	pulseTable [31]float64
+	tndTable   [203]float64
+)
+
+func init() {
+	for i := 1; i < len(pulseTable); i++ {
+		pulseTable[i] = 95.52 / (8128.0/float64(i) + 100)
+	}
+	for i := 1; i < len(tndTable); i++ {
+		tndTable[i] = 163.67 / (24329.0/float64(i) + 100)
+	}
+}
+
+//mix は各チャンネルの出力を実機と同じ非線形の式で混ぜる
+func (a *APU) mix() float64 {
+	p := pulseTable[a.pulse[0].output()+a.pulse[1].output()]
+	tnd := tndTable[3*int(a.triangle.output())+2*int(a.noise.output())+int(a.dmc.output())]
+	return p + tnd
+}
@@ -0,0 +1,73 @@
+package apu
+
+//noiseTable 周期(CPUサイクル)
+var noiseTable = [16]uint16{
+	4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068,
+}
+
+//noise ノイズチャンネル ($400C-$400F)
+type noise struct {
+	isEnabled   bool
+	isShortMode bool
+	shift       uint16
+	timer       uint16
+	timerPeriod uint16
+	length      uint8
+	isHalt      bool
+	envelope    envelope
+}
+
+func newNoise() *noise {
+	return &noise{shift: 1, timerPeriod: noiseTable[0]}
+}
+
+func (n *noise) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		n.isHalt = data&0x20 != 0x00
+		n.envelope.write(data)
+	case 2:
+		n.isShortMode = data&0x80 != 0x00
+		n.timerPeriod = noiseTable[data&0x0f]
+	case 3:
+		if n.isEnabled {
+			n.length = loadLength(data)
+		}
+		n.envelope.isStart = true
+	}
+}
+
+func (n *noise) setEnabled(isEnabled bool) {
+	n.isEnabled = isEnabled
+	if !isEnabled {
+		n.length = 0
+	}
+}
+
+//stepTimer はCPUサイクルごとに呼ぶ．15bit LFSR を進める
+func (n *noise) stepTimer() {
+	if n.timer > 0 {
+		n.timer--
+		return
+	}
+	n.timer = n.timerPeriod - 1
+	tap := uint(1)
+	if n.isShortMode {
+		tap = 6
+	}
+	feedback := (n.shift ^ n.shift>>tap) & 0x01
+	n.shift = n.shift>>1 | feedback<<14
+}
+
+func (n *noise) clockLength() {
+	if !n.isHalt && n.length > 0 {
+		n.length--
+	}
+}
+
+func (n *noise) output() uint8 {
+	if n.length == 0 || n.shift&0x01 != 0x00 {
+		return 0
+	}
+	return n.envelope.output()
+}
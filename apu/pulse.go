@@ -0,0 +1,114 @@
+package apu
+
+var dutyTable = [4][8]uint8{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+//pulse 矩形波チャンネル ($4000-$4007)
+type pulse struct {
+	//isFirst 矩形波1はスイープの減算が1の補数になる
+	isFirst     bool
+	isEnabled   bool
+	duty        uint8
+	dutyPos     uint8
+	timer       uint16
+	timerPeriod uint16
+	length      uint8
+	isHalt      bool
+	envelope    envelope
+	//sweep
+	isSweepOn     bool
+	isSweepReload bool
+	isNegate      bool
+	sweepPeriod   uint8
+	sweepShift    uint8
+	sweepDivider  uint8
+}
+
+func (p *pulse) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		p.duty = data >> 6
+		p.isHalt = data&0x20 != 0x00
+		p.envelope.write(data)
+	case 1:
+		p.isSweepOn = data&0x80 != 0x00
+		p.sweepPeriod = (data >> 4) & 0x07
+		p.isNegate = data&0x08 != 0x00
+		p.sweepShift = data & 0x07
+		p.isSweepReload = true
+	case 2:
+		p.timerPeriod = p.timerPeriod&0x0700 | uint16(data)
+	case 3:
+		p.timerPeriod = p.timerPeriod&0x00ff | uint16(data&0x07)<<8
+		if p.isEnabled {
+			p.length = loadLength(data)
+		}
+		p.dutyPos = 0
+		p.envelope.isStart = true
+	}
+}
+
+func (p *pulse) setEnabled(isEnabled bool) {
+	p.isEnabled = isEnabled
+	if !isEnabled {
+		p.length = 0
+	}
+}
+
+//stepTimer はAPUサイクル(CPU 2サイクル)ごとに呼ぶ
+func (p *pulse) stepTimer() {
+	if p.timer == 0 {
+		p.timer = p.timerPeriod
+		p.dutyPos = (p.dutyPos + 1) & 0x07
+	} else {
+		p.timer--
+	}
+}
+
+func (p *pulse) clockLength() {
+	if !p.isHalt && p.length > 0 {
+		p.length--
+	}
+}
+
+//targetPeriod はスイープ後の周期．スイープが無効でもミュート判定に使う
+func (p *pulse) targetPeriod() uint16 {
+	change := p.timerPeriod >> p.sweepShift
+	if !p.isNegate {
+		return p.timerPeriod + change
+	}
+	if p.isFirst {
+		change++
+	}
+	if change > p.timerPeriod {
+		return 0
+	}
+	return p.timerPeriod - change
+}
+
+func (p *pulse) isMuted() bool {
+	return p.timerPeriod < 8 || p.targetPeriod() > 0x07ff
+}
+
+func (p *pulse) clockSweep() {
+	if p.sweepDivider == 0 && p.isSweepOn && p.sweepShift > 0 && !p.isMuted() {
+		p.timerPeriod = p.targetPeriod()
+	}
+	if p.sweepDivider == 0 || p.isSweepReload {
+		p.sweepDivider = p.sweepPeriod
+		p.isSweepReload = false
+	} else {
+		p.sweepDivider--
+	}
+}
+
+func (p *pulse) output() uint8 {
+	if p.length == 0 || p.isMuted() || dutyTable[p.duty][p.dutyPos] == 0 {
+		return 0
+	}
+	return p.envelope.output()
+}
@@ -0,0 +1,83 @@
+package apu
+
+import "math"
+
+const (
+	blipTaps   = 16
+	blipPhases = 64
+)
+
+//blipKernel は小数位置ごとの帯域制限インパルス(窓付きsinc)
+var blipKernel [blipPhases][blipTaps]float64
+
+func init() {
+	//出力のナイキスト周波数より少し下で切る
+	const cutoff = 0.45
+	for p := 0; p < blipPhases; p++ {
+		f := float64(p) / blipPhases
+		sum := 0.0
+		for j := 0; j < blipTaps; j++ {
+			x := float64(j) - (blipTaps/2 - 1) - f
+			h := 2 * cutoff
+			if x != 0 {
+				h = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+			}
+			//Blackman窓
+			w := (x + blipTaps/2) / blipTaps
+			h *= 0.42 - 0.5*math.Cos(2*math.Pi*w) + 0.08*math.Cos(4*math.Pi*w)
+			blipKernel[p][j] = h
+			sum += h
+		}
+		for j := range blipKernel[p] {
+			blipKernel[p][j] /= sum
+		}
+	}
+}
+
+//resampler はCPUクロックで変化する振幅を帯域制限ステップとして
+//出力側のサンプル列に足し込み，積分して取り出す (blip buffer 方式)
+type resampler struct {
+	//step は1CPUサイクルあたりの出力サンプル数
+	step   float64
+	time   float64
+	buffer []float64
+	last   float64
+	sum    float64
+}
+
+func newResampler(rate int) *resampler {
+	return &resampler{step: float64(rate) / cpuClock}
+}
+
+//add は1CPUサイクル分の振幅を入れる
+func (r *resampler) add(v float64) {
+	if d := v - r.last; d != 0 {
+		r.last = v
+		i := int(r.time)
+		if n := i + blipTaps; n > len(r.buffer) {
+			r.buffer = append(r.buffer, make([]float64, n-len(r.buffer))...)
+		}
+		k := &blipKernel[int((r.time-float64(i))*blipPhases)]
+		for j := 0; j < blipTaps; j++ {
+			r.buffer[i+j] += d * k[j]
+		}
+	}
+	r.time += r.step
+}
+
+//read は確定したサンプルを out に渡してバッファから取り除く
+func (r *resampler) read(out func(float64)) {
+	n := int(r.time)
+	if n == 0 {
+		return
+	}
+	if n > len(r.buffer) {
+		r.buffer = append(r.buffer, make([]float64, n-len(r.buffer))...)
+	}
+	for i := 0; i < n; i++ {
+		r.sum += r.buffer[i]
+		out(r.sum)
+	}
+	r.buffer = r.buffer[:copy(r.buffer, r.buffer[n:])]
+	r.time -= float64(n)
+}
@@ -0,0 +1,253 @@
+package apu
+
+//State はセーブステートに書き出すAPUの状態．出力段(リサンプラとフィルタ)は含めない
+type State struct {
+	Pulse    [2]PulseState
+	Triangle TriangleState
+	Noise    NoiseState
+	DMC      DMCState
+	Cycle    int
+	//フレームシーケンサ
+	FrameCycle   int
+	IsFiveStep   bool
+	FrameReset   int
+	IsIRQInhibit bool
+	IsFrameIRQ   bool
+}
+
+//EnvelopeState などはチャンネルごとの状態
+type EnvelopeState struct {
+	IsStart    bool
+	IsLoop     bool
+	IsConstant bool
+	Volume     uint8
+	Divider    uint8
+	Decay      uint8
+}
+
+type PulseState struct {
+	IsEnabled     bool
+	Duty          uint8
+	DutyPos       uint8
+	Timer         uint16
+	TimerPeriod   uint16
+	Length        uint8
+	IsHalt        bool
+	Envelope      EnvelopeState
+	IsSweepOn     bool
+	IsSweepReload bool
+	IsNegate      bool
+	SweepPeriod   uint8
+	SweepShift    uint8
+	SweepDivider  uint8
+}
+
+type TriangleState struct {
+	IsEnabled      bool
+	Sequence       uint8
+	Timer          uint16
+	TimerPeriod    uint16
+	Length         uint8
+	IsControl      bool
+	Linear         uint8
+	LinearReload   uint8
+	IsLinearReload bool
+}
+
+type NoiseState struct {
+	IsEnabled   bool
+	IsShortMode bool
+	Shift       uint16
+	Timer       uint16
+	TimerPeriod uint16
+	Length      uint8
+	IsHalt      bool
+	Envelope    EnvelopeState
+}
+
+type DMCState struct {
+	IsLoop         bool
+	IsIRQOn        bool
+	IsIRQ          bool
+	Timer          uint16
+	TimerPeriod    uint16
+	Level          uint8
+	SampleAddr     uint16
+	SampleLength   uint16
+	CurrentAddr    uint16
+	BytesRemaining uint16
+	Buffer         uint8
+	IsBufferEmpty  bool
+	Shift          uint8
+	BitsRemaining  uint8
+	IsSilence      bool
+	Stall          int
+}
+
+//SaveState は現在の状態を返す
+func (a *APU) SaveState() State {
+	return State{
+		Pulse:        [2]PulseState{a.pulse[0].state(), a.pulse[1].state()},
+		Triangle:     a.triangle.state(),
+		Noise:        a.noise.state(),
+		DMC:          a.dmc.state(),
+		Cycle:        a.cycle,
+		FrameCycle:   a.frameCycle,
+		IsFiveStep:   a.isFiveStep,
+		FrameReset:   a.frameReset,
+		IsIRQInhibit: a.isIRQInhibit,
+		IsFrameIRQ:   a.isFrameIRQ,
+	}
+}
+
+//LoadState は SaveState で取った状態に戻す．溜まっていたPCMは捨てる
+func (a *APU) LoadState(s State) {
+	a.pulse[0].load(s.Pulse[0])
+	a.pulse[1].load(s.Pulse[1])
+	a.triangle.load(s.Triangle)
+	a.noise.load(s.Noise)
+	a.dmc.load(s.DMC)
+	a.cycle = s.Cycle
+	a.frameCycle = s.FrameCycle
+	a.isFiveStep = s.IsFiveStep
+	a.frameReset = s.FrameReset
+	a.isIRQInhibit = s.IsIRQInhibit
+	a.isFrameIRQ = s.IsFrameIRQ
+	a.samples = nil
+	return
+}
+
+func (e *envelope) state() EnvelopeState {
+	return EnvelopeState{e.isStart, e.isLoop, e.isConstant, e.volume, e.divider, e.decay}
+}
+
+func (e *envelope) load(s EnvelopeState) {
+	*e = envelope{s.IsStart, s.IsLoop, s.IsConstant, s.Volume & 0x0f, s.Divider & 0x0f, s.Decay & 0x0f}
+}
+
+func (p *pulse) state() PulseState {
+	return PulseState{
+		IsEnabled:     p.isEnabled,
+		Duty:          p.duty,
+		DutyPos:       p.dutyPos,
+		Timer:         p.timer,
+		TimerPeriod:   p.timerPeriod,
+		Length:        p.length,
+		IsHalt:        p.isHalt,
+		Envelope:      p.envelope.state(),
+		IsSweepOn:     p.isSweepOn,
+		IsSweepReload: p.isSweepReload,
+		IsNegate:      p.isNegate,
+		SweepPeriod:   p.sweepPeriod,
+		SweepShift:    p.sweepShift,
+		SweepDivider:  p.sweepDivider,
+	}
+}
+
+func (p *pulse) load(s PulseState) {
+	p.isEnabled = s.IsEnabled
+	//テーブルの添字は範囲に収める
+	p.duty = s.Duty & 0x03
+	p.dutyPos = s.DutyPos & 0x07
+	p.timer = s.Timer
+	p.timerPeriod = s.TimerPeriod
+	p.length = s.Length
+	p.isHalt = s.IsHalt
+	p.envelope.load(s.Envelope)
+	p.isSweepOn = s.IsSweepOn
+	p.isSweepReload = s.IsSweepReload
+	p.isNegate = s.IsNegate
+	p.sweepPeriod = s.SweepPeriod
+	p.sweepShift = s.SweepShift
+	p.sweepDivider = s.SweepDivider
+}
+
+func (t *triangle) state() TriangleState {
+	return TriangleState{
+		IsEnabled:      t.isEnabled,
+		Sequence:       t.sequence,
+		Timer:          t.timer,
+		TimerPeriod:    t.timerPeriod,
+		Length:         t.length,
+		IsControl:      t.isControl,
+		Linear:         t.linear,
+		LinearReload:   t.linearReload,
+		IsLinearReload: t.isLinearReload,
+	}
+}
+
+func (t *triangle) load(s TriangleState) {
+	t.isEnabled = s.IsEnabled
+	t.sequence = s.Sequence & 0x1f
+	t.timer = s.Timer
+	t.timerPeriod = s.TimerPeriod
+	t.length = s.Length
+	t.isControl = s.IsControl
+	t.linear = s.Linear
+	t.linearReload = s.LinearReload
+	t.isLinearReload = s.IsLinearReload
+}
+
+func (n *noise) state() NoiseState {
+	return NoiseState{
+		IsEnabled:   n.isEnabled,
+		IsShortMode: n.isShortMode,
+		Shift:       n.shift,
+		Timer:       n.timer,
+		TimerPeriod: n.timerPeriod,
+		Length:      n.length,
+		IsHalt:      n.isHalt,
+		Envelope:    n.envelope.state(),
+	}
+}
+
+func (n *noise) load(s NoiseState) {
+	n.isEnabled = s.IsEnabled
+	n.isShortMode = s.IsShortMode
+	n.shift = s.Shift
+	n.timer = s.Timer
+	n.timerPeriod = s.TimerPeriod
+	n.length = s.Length
+	n.isHalt = s.IsHalt
+	n.envelope.load(s.Envelope)
+}
+
+func (d *dmc) state() DMCState {
+	return DMCState{
+		IsLoop:         d.isLoop,
+		IsIRQOn:        d.isIRQOn,
+		IsIRQ:          d.isIRQ,
+		Timer:          d.timer,
+		TimerPeriod:    d.timerPeriod,
+		Level:          d.level,
+		SampleAddr:     d.sampleAddr,
+		SampleLength:   d.sampleLength,
+		CurrentAddr:    d.currentAddr,
+		BytesRemaining: d.bytesRemaining,
+		Buffer:         d.buffer,
+		IsBufferEmpty:  d.isBufferEmpty,
+		Shift:          d.shift,
+		BitsRemaining:  d.bitsRemaining,
+		IsSilence:      d.isSilence,
+		Stall:          d.stall,
+	}
+}
+
+func (d *dmc) load(s DMCState) {
+	d.isLoop = s.IsLoop
+	d.isIRQOn = s.IsIRQOn
+	d.isIRQ = s.IsIRQ
+	d.timer = s.Timer
+	d.timerPeriod = s.TimerPeriod
+	d.level = s.Level & 0x7f
+	d.sampleAddr = s.SampleAddr
+	d.sampleLength = s.SampleLength
+	d.currentAddr = s.CurrentAddr
+	d.bytesRemaining = s.BytesRemaining
+	d.buffer = s.Buffer
+	d.isBufferEmpty = s.IsBufferEmpty
+	d.shift = s.Shift
+	d.bitsRemaining = s.BitsRemaining
+	d.isSilence = s.IsSilence
+	d.stall = s.Stall
+}
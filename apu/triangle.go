@@ -0,0 +1,77 @@
+package apu
+
+var triangleTable = [32]uint8{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+//triangle 三角波チャンネル ($4008-$400B)
+type triangle struct {
+	isEnabled   bool
+	sequence    uint8
+	timer       uint16
+	timerPeriod uint16
+	length      uint8
+	//isControl は長さカウンタの停止と線形カウンタの再ロード継続を兼ねる
+	isControl      bool
+	linear         uint8
+	linearReload   uint8
+	isLinearReload bool
+}
+
+func (t *triangle) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		t.isControl = data&0x80 != 0x00
+		t.linearReload = data & 0x7f
+	case 2:
+		t.timerPeriod = t.timerPeriod&0x0700 | uint16(data)
+	case 3:
+		t.timerPeriod = t.timerPeriod&0x00ff | uint16(data&0x07)<<8
+		if t.isEnabled {
+			t.length = loadLength(data)
+		}
+		t.isLinearReload = true
+	}
+}
+
+func (t *triangle) setEnabled(isEnabled bool) {
+	t.isEnabled = isEnabled
+	if !isEnabled {
+		t.length = 0
+	}
+}
+
+//stepTimer はCPUサイクルごとに呼ぶ
+func (t *triangle) stepTimer() {
+	if t.timer > 0 {
+		t.timer--
+		return
+	}
+	t.timer = t.timerPeriod
+	if t.length > 0 && t.linear > 0 {
+		t.sequence = (t.sequence + 1) & 0x1f
+	}
+}
+
+func (t *triangle) clockLength() {
+	if !t.isControl && t.length > 0 {
+		t.length--
+	}
+}
+
+func (t *triangle) clockLinear() {
+	if t.isLinearReload {
+		t.linear = t.linearReload
+	} else if t.linear > 0 {
+		t.linear--
+	}
+	if !t.isControl {
+		t.isLinearReload = false
+	}
+}
+
+//output は止まっても最後の段の値を出し続ける
+func (t *triangle) output() uint8 {
+	return triangleTable[t.sequence]
+}
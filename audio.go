@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/pishiko/gones/apu"
+)
+
+//maxAudioBuffer を超えた分は古い方から捨てて遅延を抑える (0.2秒)
+const maxAudioBuffer = apu.SampleRate / 5 * 4
+
+//audioStream はエミュレータが出したPCMをebitenのプレイヤーへ渡す
+type audioStream struct {
+	mu     sync.Mutex
+	buffer []byte
+}
+
+//Write はモノラル16bitのサンプルを 16bit ステレオ LE にして溜める
+func (s *audioStream) Write(samples []int16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range samples {
+		s.buffer = append(s.buffer, byte(v), byte(v>>8), byte(v), byte(v>>8))
+	}
+	if len(s.buffer) > maxAudioBuffer {
+		s.buffer = s.buffer[len(s.buffer)-maxAudioBuffer:]
+	}
+}
+
+//Read は溜まったPCMを返す．足りない分は無音で埋める
+func (s *audioStream) Read(buf []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := copy(buf, s.buffer)
+	s.buffer = s.buffer[n:]
+	for i := n; i < len(buf); i++ {
+		buf[i] = 0
+	}
+	return len(buf), nil
+}
@@ -0,0 +1,58 @@
+package cartridge
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//SavePath はROMと同じディレクトリに置く .sav のパスを返す
+func SavePath(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".sav"
+}
+
+//HasBattery はPRG-RAMをファイルに保存すべきならtrue
+func (c *Cartridge) HasBattery() bool {
+	return c.Info.HasBattery && len(c.PRGRAM) > 0
+}
+
+//LoadSRAM は .sav からPRG-RAMを復元する．ファイルが無ければ何もしない
+func (c *Cartridge) LoadSRAM(path string) error {
+	if !c.HasBattery() {
+		return nil
+	}
+	c.savedRAM = append(c.savedRAM[:0], c.PRGRAM...)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) != len(c.PRGRAM) {
+		return fmt.Errorf("cartridge: %s is %d bytes, expected %d", path, len(data), len(c.PRGRAM))
+	}
+	copy(c.PRGRAM, data)
+	c.savedRAM = append(c.savedRAM[:0], data...)
+	return nil
+}
+
+//SaveSRAM はPRG-RAMが前回の保存から変わっていれば .sav に書き出す
+func (c *Cartridge) SaveSRAM(path string) error {
+	if !c.HasBattery() || bytes.Equal(c.PRGRAM, c.savedRAM) {
+		return nil
+	}
+	//途中で落ちても元のファイルが壊れないよう一時ファイルから置き換える
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, c.PRGRAM, 0666); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	c.savedRAM = append(c.savedRAM[:0], c.PRGRAM...)
+	return nil
+}
@@ -0,0 +1,93 @@
+package cartridge
+
+import "fmt"
+
+//Mirroring はネームテーブルの配線
+type Mirroring int
+
+const (
+	//MirrorHorizontal $2000=$2400, $2800=$2C00
+	MirrorHorizontal Mirroring = iota
+	//MirrorVertical $2000=$2800, $2400=$2C00
+	MirrorVertical
+	//MirrorSingleLower 全テーブルが VRAM 前半
+	MirrorSingleLower
+	//MirrorSingleUpper 全テーブルが VRAM 後半
+	MirrorSingleUpper
+	//MirrorFourScreen カートリッジ側に4画面分のVRAM
+	MirrorFourScreen
+)
+
+//Cartridge はROMイメージと基板(Mapper)をまとめたもの
+type Cartridge struct {
+	Info     RomInfo
+	PRG      []uint8
+	CHR      []uint8
+	PRGRAM   []uint8
+	IsCHRRAM bool
+	Mirror   Mirroring
+	//MMC3RevA はMMC3のIRQを旧仕様(Rev A)の挙動にする
+	MMC3RevA bool
+	Mapper
+	//savedRAM は最後に .sav へ書き出した内容
+	savedRAM []uint8
+}
+
+//New はヘッダ情報に従ってMapperを選んでカートリッジを組み立てる
+func New(info *RomInfo, prg, chr []uint8) (*Cartridge, error) {
+	if len(prg) == 0 || len(prg)%0x2000 != 0 {
+		return nil, fmt.Errorf("cartridge: PRG-ROM size %d is not a multiple of 8KB", len(prg))
+	}
+	if len(chr)%0x2000 != 0 {
+		return nil, fmt.Errorf("cartridge: CHR-ROM size %d is not a multiple of 8KB", len(chr))
+	}
+	//8KBのPRGは16KBにミラーしておく
+	if len(prg) == 0x2000 {
+		prg = append(append([]uint8{}, prg...), prg...)
+	}
+
+	c := &Cartridge{Info: *info, PRG: prg, CHR: chr}
+	c.PRGRAM = make([]uint8, info.PRGRAMSize+info.PRGNVRAMSize)
+	if len(chr) == 0 {
+		size := info.CHRRAMSize + info.CHRNVRAMSize
+		if size < 0x2000 {
+			size = 0x2000
+		}
+		c.CHR = make([]uint8, size)
+		c.IsCHRRAM = true
+	}
+	c.Mirror = info.Mirroring
+	//MMC3 submapper 4 は MMC3A
+	c.MMC3RevA = info.Mapper == 4 && info.Submapper == 4
+
+	m, err := newMapper(c)
+	if err != nil {
+		return nil, err
+	}
+	c.Mapper = m
+	return c, nil
+}
+
+func newMapper(c *Cartridge) (Mapper, error) {
+	switch c.Info.Mapper {
+	case 0:
+		return newNROM(c), nil
+	case 1:
+		return newMMC1(c), nil
+	case 2:
+		return newUxROM(c), nil
+	case 3:
+		return newCNROM(c), nil
+	case 4:
+		return newMMC3(c), nil
+	case 7:
+		return newAxROM(c), nil
+	case 11:
+		return newColorDreams(c), nil
+	case 34:
+		return newBNROM(c), nil
+	case 66:
+		return newGxROM(c), nil
+	}
+	return nil, fmt.Errorf("cartridge: unsupported mapper %d", c.Info.Mapper)
+}
@@ -0,0 +1,284 @@
+package cartridge
+
+//ディスクリートロジックの基板．多くはROMと書き込み値がバス上でぶつかる(バスコンフリクト)
+
+//latch は $8000-$FFFF への書き込みを1つのラッチに保持する基板の共通部分
+type latch struct {
+	board
+	value         uint8
+	isBusConflict bool
+}
+
+//readLow は $8000 未満の読み出し．PRG-RAMがあれば $6000-$7FFF に見える
+func (l *latch) readLow(addr uint16) uint8 {
+	if addr >= 0x6000 {
+		return l.readPRGRAM(addr)
+	}
+	return 0x00
+}
+
+//write は $8000- ならラッチ，$6000-$7FFF ならPRG-RAMへ書き込む
+func (l *latch) write(m Mapper, addr uint16, data uint8) {
+	switch {
+	case addr >= 0x8000:
+		l.writeLatch(m, addr, data)
+	case addr >= 0x6000:
+		l.writePRGRAM(addr, data)
+	}
+}
+
+//writeLatch はバスコンフリクトを考慮してラッチへ書き込む
+func (l *latch) writeLatch(m Mapper, addr uint16, data uint8) {
+	if l.isBusConflict {
+		data &= m.ReadCPU(addr)
+	}
+	l.value = data
+}
+
+func (l *latch) stateFields() map[string]interface{} {
+	return map[string]interface{}{"value": &l.value}
+}
+
+//hasBusConflict は NES 2.0 submapper (1:無し 2:有り) があればそれに従う
+func hasBusConflict(c *Cartridge, def bool) bool {
+	switch c.Info.Submapper {
+	case 1:
+		return false
+	case 2:
+		return true
+	}
+	return def
+}
+
+//prg32 は32KB単位のPRGバンクを読む
+func (l *latch) prg32(bank int, addr uint16) uint8 {
+	banks := len(l.PRG) / 0x8000
+	if banks == 0 {
+		return l.PRG[int(addr-0x8000)%len(l.PRG)]
+	}
+	return l.PRG[bank%banks*0x8000+int(addr-0x8000)]
+}
+
+//chr8 は8KB単位のCHRバンクのオフセット
+func (l *latch) chr8(bank int, addr uint16) int {
+	return bank%(len(l.CHR)/0x2000)*0x2000 + int(addr)
+}
+
+//uxrom Mapper 2
+type uxrom struct {
+	latch
+}
+
+func newUxROM(c *Cartridge) *uxrom {
+	return &uxrom{latch{board: board{c}, isBusConflict: hasBusConflict(c, true)}}
+}
+
+func (m *uxrom) ReadCPU(addr uint16) uint8 {
+	switch {
+	case addr >= 0xc000:
+		return m.PRG[len(m.PRG)-0x4000+int(addr-0xc000)]
+	case addr >= 0x8000:
+		banks := len(m.PRG) / 0x4000
+		return m.PRG[int(m.value)%banks*0x4000+int(addr-0x8000)]
+	}
+	return m.readLow(addr)
+}
+
+func (m *uxrom) WriteCPU(addr uint16, data uint8) {
+	m.write(m, addr, data)
+}
+
+//cnrom Mapper 3
+type cnrom struct {
+	latch
+}
+
+func newCNROM(c *Cartridge) *cnrom {
+	return &cnrom{latch{board: board{c}, isBusConflict: hasBusConflict(c, true)}}
+}
+
+func (m *cnrom) ReadCPU(addr uint16) uint8 {
+	if addr < 0x8000 {
+		return m.readLow(addr)
+	}
+	return m.PRG[int(addr-0x8000)%len(m.PRG)]
+}
+
+func (m *cnrom) WriteCPU(addr uint16, data uint8) {
+	m.write(m, addr, data)
+}
+
+func (m *cnrom) ReadPPU(addr uint16) uint8 {
+	return m.CHR[m.chr8(int(m.value), addr)]
+}
+
+func (m *cnrom) WritePPU(addr uint16, data uint8) {
+	if m.IsCHRRAM {
+		m.CHR[m.chr8(int(m.value), addr)] = data
+	}
+}
+
+//axrom Mapper 7．1画面ミラーリングを切り替える
+type axrom struct {
+	latch
+}
+
+func newAxROM(c *Cartridge) *axrom {
+	//AOROM はバスコンフリクトが無い
+	return &axrom{latch{board: board{c}, isBusConflict: hasBusConflict(c, false)}}
+}
+
+func (m *axrom) ReadCPU(addr uint16) uint8 {
+	if addr < 0x8000 {
+		return m.readLow(addr)
+	}
+	return m.prg32(int(m.value&0x07), addr)
+}
+
+func (m *axrom) WriteCPU(addr uint16, data uint8) {
+	m.write(m, addr, data)
+}
+
+func (m *axrom) Mirroring() Mirroring {
+	if m.value&0x10 != 0x00 {
+		return MirrorSingleUpper
+	}
+	return MirrorSingleLower
+}
+
+//gxrom Mapper 66
+type gxrom struct {
+	latch
+}
+
+func newGxROM(c *Cartridge) *gxrom {
+	return &gxrom{latch{board: board{c}, isBusConflict: true}}
+}
+
+func (m *gxrom) ReadCPU(addr uint16) uint8 {
+	if addr < 0x8000 {
+		return m.readLow(addr)
+	}
+	return m.prg32(int(m.value>>4)&0x03, addr)
+}
+
+func (m *gxrom) WriteCPU(addr uint16, data uint8) {
+	m.write(m, addr, data)
+}
+
+func (m *gxrom) ReadPPU(addr uint16) uint8 {
+	return m.CHR[m.chr8(int(m.value&0x03), addr)]
+}
+
+func (m *gxrom) WritePPU(addr uint16, data uint8) {
+	if m.IsCHRRAM {
+		m.CHR[m.chr8(int(m.value&0x03), addr)] = data
+	}
+}
+
+//colorDreams Mapper 11
+type colorDreams struct {
+	latch
+}
+
+func newColorDreams(c *Cartridge) *colorDreams {
+	return &colorDreams{latch{board: board{c}, isBusConflict: true}}
+}
+
+func (m *colorDreams) ReadCPU(addr uint16) uint8 {
+	if addr < 0x8000 {
+		return m.readLow(addr)
+	}
+	return m.prg32(int(m.value&0x03), addr)
+}
+
+func (m *colorDreams) WriteCPU(addr uint16, data uint8) {
+	m.write(m, addr, data)
+}
+
+func (m *colorDreams) ReadPPU(addr uint16) uint8 {
+	return m.CHR[m.chr8(int(m.value>>4), addr)]
+}
+
+func (m *colorDreams) WritePPU(addr uint16, data uint8) {
+	if m.IsCHRRAM {
+		m.CHR[m.chr8(int(m.value>>4), addr)] = data
+	}
+}
+
+//bnrom Mapper 34．NES 2.0 の submapper (1: NINA-001, 2: BNROM) で基板を決める．
+//書かれていなければ CHR-ROM が8KBより大きいとき NINA-001 として動く
+type bnrom struct {
+	latch
+	isNINA  bool
+	chrBank [2]uint8
+}
+
+func newBNROM(c *Cartridge) *bnrom {
+	m := &bnrom{latch: latch{board: board{c}}}
+	switch {
+	case c.Info.IsNES20 && c.Info.Submapper == 1:
+		m.isNINA = true
+	case c.Info.IsNES20 && c.Info.Submapper == 2:
+		m.isNINA = false
+	default:
+		m.isNINA = !c.IsCHRRAM && len(c.CHR) > 0x2000
+	}
+	m.isBusConflict = !m.isNINA
+	m.chrBank[1] = 1
+	return m
+}
+
+func (m *bnrom) stateFields() map[string]interface{} {
+	return map[string]interface{}{"value": &m.value, "chrBank": &m.chrBank}
+}
+
+func (m *bnrom) ReadCPU(addr uint16) uint8 {
+	switch {
+	case addr >= 0x8000:
+		return m.prg32(int(m.value), addr)
+	case addr >= 0x6000:
+		return m.readPRGRAM(addr)
+	}
+	return 0x00
+}
+
+func (m *bnrom) WriteCPU(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x8000:
+		if !m.isNINA {
+			m.writeLatch(m, addr, data)
+		}
+	case addr >= 0x6000:
+		m.writePRGRAM(addr, data)
+		if !m.isNINA {
+			return
+		}
+		switch addr {
+		case 0x7ffd:
+			m.value = data & 0x01
+		case 0x7ffe:
+			m.chrBank[0] = data & 0x0f
+		case 0x7fff:
+			m.chrBank[1] = data & 0x0f
+		}
+	}
+}
+
+func (m *bnrom) chrIndex(addr uint16) int {
+	if !m.isNINA {
+		return int(addr) % len(m.CHR)
+	}
+	banks := len(m.CHR) / 0x1000
+	return int(m.chrBank[addr/0x1000])%banks*0x1000 + int(addr%0x1000)
+}
+
+func (m *bnrom) ReadPPU(addr uint16) uint8 {
+	return m.CHR[m.chrIndex(addr)]
+}
+
+func (m *bnrom) WritePPU(addr uint16, data uint8) {
+	if m.IsCHRRAM {
+		m.CHR[m.chrIndex(addr)] = data
+	}
+}
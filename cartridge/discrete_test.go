@@ -0,0 +1,37 @@
+package cartridge
+
+import "testing"
+
+func TestBNROMBoard(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     RomInfo
+		chrSize  int
+		wantNINA bool
+	}{
+		{"iNES 8KB CHR-RAM", RomInfo{}, 0, false},
+		{"iNES 8KB CHR-ROM", RomInfo{}, 0x2000, false},
+		{"iNES 64KB CHR-ROM", RomInfo{}, 0x10000, true},
+		{"NES 2.0 unspecified", RomInfo{IsNES20: true}, 0x10000, true},
+		{"NES 2.0 NINA-001 with 8KB CHR", RomInfo{IsNES20: true, Submapper: 1}, 0x2000, true},
+		{"NES 2.0 BNROM with 64KB CHR", RomInfo{IsNES20: true, Submapper: 2}, 0x10000, false},
+	}
+	for _, tt := range tests {
+		info := tt.info
+		info.Mapper = 34
+		info.PRGROMSize = 0x10000
+		info.CHRROMSize = tt.chrSize
+		info.PRGRAMSize = 0x2000
+		c, err := New(&info, make([]uint8, 0x10000), make([]uint8, tt.chrSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := c.Mapper.(*bnrom)
+		if m.isNINA != tt.wantNINA {
+			t.Errorf("%s: NINA-001 = %v, want %v", tt.name, m.isNINA, tt.wantNINA)
+		}
+		if m.isBusConflict == m.isNINA {
+			t.Errorf("%s: bus conflicts = %v", tt.name, m.isBusConflict)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package cartridge
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	headerSize  = 16
+	trainerSize = 512
+)
+
+//Timing はROMが想定するCPU/PPUのタイミング
+type Timing int
+
+const (
+	TimingNTSC Timing = iota
+	TimingPAL
+	TimingMulti
+	TimingDendy
+)
+
+//ConsoleType はROMが想定する本体
+type ConsoleType int
+
+const (
+	ConsoleNES ConsoleType = iota
+	ConsoleVsSystem
+	ConsolePlaychoice10
+	ConsoleExtended
+)
+
+//RomInfo はiNES/NES 2.0 ヘッダの内容．サイズは全てバイト単位
+type RomInfo struct {
+	IsNES20    bool
+	Mapper     int
+	Submapper  int
+	PRGROMSize int
+	CHRROMSize int
+	//PRG-RAM/CHR-RAM のうちバッテリーで保持されない分と保持される分
+	PRGRAMSize   int
+	PRGNVRAMSize int
+	CHRRAMSize   int
+	CHRNVRAMSize int
+	Mirroring    Mirroring
+	HasBattery   bool
+	HasTrainer   bool
+	Timing       Timing
+	Console      ConsoleType
+	//ExtendedConsole は Console が ConsoleExtended のときの種別 (byte 13)
+	ExtendedConsole int
+	ExpansionDevice int
+}
+
+//ParseHeader は16バイトのヘッダを解釈する
+func ParseHeader(header []uint8) (*RomInfo, error) {
+	if len(header) < headerSize {
+		return nil, fmt.Errorf("cartridge: header is %d bytes, need %d", len(header), headerSize)
+	}
+	if !bytes.Equal(header[0:4], []byte("NES\x1a")) {
+		return nil, fmt.Errorf("cartridge: missing iNES signature (got % X)", header[0:4])
+	}
+
+	info := &RomInfo{}
+	info.HasBattery = header[6]&0x02 != 0x00
+	info.HasTrainer = header[6]&0x04 != 0x00
+	switch {
+	case header[6]&0x08 != 0x00:
+		info.Mirroring = MirrorFourScreen
+	case header[6]&0x01 != 0x00:
+		info.Mirroring = MirrorVertical
+	default:
+		info.Mirroring = MirrorHorizontal
+	}
+	info.Mapper = int(header[6] >> 4)
+	info.Console = ConsoleType(header[7] & 0x03)
+	info.IsNES20 = header[7]&0x0c == 0x08
+
+	if info.IsNES20 {
+		info.Mapper |= int(header[7]&0xf0) | int(header[8]&0x0f)<<8
+		info.Submapper = int(header[8] >> 4)
+
+		var err error
+		info.PRGROMSize, err = romSize(header[4], header[9]&0x0f, 0x4000)
+		if err != nil {
+			return nil, fmt.Errorf("cartridge: PRG-ROM size: %v", err)
+		}
+		info.CHRROMSize, err = romSize(header[5], header[9]>>4, 0x2000)
+		if err != nil {
+			return nil, fmt.Errorf("cartridge: CHR-ROM size: %v", err)
+		}
+		info.PRGRAMSize = ramSize(header[10] & 0x0f)
+		info.PRGNVRAMSize = ramSize(header[10] >> 4)
+		info.CHRRAMSize = ramSize(header[11] & 0x0f)
+		info.CHRNVRAMSize = ramSize(header[11] >> 4)
+		info.Timing = Timing(header[12] & 0x03)
+		if info.Console == ConsoleExtended {
+			info.ExtendedConsole = int(header[13] & 0x0f)
+		}
+		info.ExpansionDevice = int(header[15] & 0x3f)
+	} else {
+		//古いダンプツールはbyte 7-15 にゴミを書いていることがある
+		if bytes.Equal(header[12:16], []byte{0, 0, 0, 0}) {
+			info.Mapper |= int(header[7] & 0xf0)
+		} else {
+			info.Console = ConsoleNES
+		}
+		info.PRGROMSize = int(header[4]) * 0x4000
+		info.CHRROMSize = int(header[5]) * 0x2000
+		ram := int(header[8]) * 0x2000
+		if ram == 0 {
+			ram = 0x2000
+		}
+		if info.HasBattery {
+			info.PRGNVRAMSize = ram
+		} else {
+			info.PRGRAMSize = ram
+		}
+		if info.CHRROMSize == 0 {
+			info.CHRRAMSize = 0x2000
+		}
+		if header[9]&0x01 != 0x00 {
+			info.Timing = TimingPAL
+		}
+	}
+
+	if info.PRGROMSize == 0 {
+		return nil, fmt.Errorf("cartridge: header declares no PRG-ROM")
+	}
+	return info, nil
+}
+
+//romSize は NES 2.0 のROMサイズ．上位nibbleが$Fなら指数表記
+func romSize(lsb, msb uint8, unit int) (int, error) {
+	if msb != 0x0f {
+		return (int(msb)<<8 | int(lsb)) * unit, nil
+	}
+	exponent := uint(lsb >> 2)
+	multiplier := int(lsb&0x03)*2 + 1
+	if exponent > 30 {
+		return 0, fmt.Errorf("2^%d*%d bytes is too large", exponent, multiplier)
+	}
+	return (1 << exponent) * multiplier, nil
+}
+
+//ramSize は NES 2.0 のRAMサイズ (64 << shift)
+func ramSize(shift uint8) int {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
+
+//Load はiNESイメージ全体を検証してカートリッジを組み立てる
+func Load(data []uint8) (*Cartridge, error) {
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("cartridge: image is %d bytes, shorter than the %d-byte header", len(data), headerSize)
+	}
+	info, err := ParseHeader(data[:headerSize])
+	if err != nil {
+		return nil, err
+	}
+
+	offset := headerSize
+	var trainer []uint8
+	if info.HasTrainer {
+		if len(data) < offset+trainerSize {
+			return nil, fmt.Errorf("cartridge: header declares a trainer but image is truncated at %d bytes", len(data))
+		}
+		trainer = data[offset : offset+trainerSize]
+		offset += trainerSize
+	}
+	if len(data) < offset+info.PRGROMSize {
+		return nil, fmt.Errorf("cartridge: header declares %d bytes of PRG-ROM but only %d remain", info.PRGROMSize, len(data)-offset)
+	}
+	prg := data[offset : offset+info.PRGROMSize]
+	offset += info.PRGROMSize
+	if len(data) < offset+info.CHRROMSize {
+		return nil, fmt.Errorf("cartridge: header declares %d bytes of CHR-ROM but only %d remain", info.CHRROMSize, len(data)-offset)
+	}
+	chr := data[offset : offset+info.CHRROMSize]
+
+	//トレーナーは $7000-$71FF に置かれるので，PRG-RAMが8KBに満たなければ広げる
+	if trainer != nil && info.PRGRAMSize+info.PRGNVRAMSize < 0x2000 {
+		if info.HasBattery {
+			info.PRGNVRAMSize = 0x2000 - info.PRGRAMSize
+		} else {
+			info.PRGRAMSize = 0x2000 - info.PRGNVRAMSize
+		}
+	}
+	c, err := New(info, prg, chr)
+	if err != nil {
+		return nil, err
+	}
+	if trainer != nil {
+		copy(c.PRGRAM[0x1000:], trainer)
+	}
+	return c, nil
+}
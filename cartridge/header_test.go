@@ -0,0 +1,136 @@
+package cartridge
+
+import (
+	"strings"
+	"testing"
+)
+
+//header は iNES ヘッダを作る．bytes 4-15 を順に並べる
+func header(b ...uint8) []uint8 {
+	h := make([]uint8, headerSize)
+	copy(h, "NES\x1a")
+	copy(h[4:], b)
+	return h
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []uint8
+		want   RomInfo
+	}{
+		{
+			name:   "iNES NROM",
+			header: header(2, 1, 0x01),
+			want:   RomInfo{PRGROMSize: 0x8000, CHRROMSize: 0x2000, PRGRAMSize: 0x2000, Mirroring: MirrorVertical},
+		},
+		{
+			name:   "iNES battery, trainer, four-screen and CHR-RAM",
+			header: header(1, 0, 0x4e, 0x10, 2),
+			want: RomInfo{Mapper: 0x14, PRGROMSize: 0x4000, PRGNVRAMSize: 0x4000, CHRRAMSize: 0x2000,
+				Mirroring: MirrorFourScreen, HasBattery: true, HasTrainer: true},
+		},
+		{
+			name:   "iNES garbage in bytes 7-15 drops the upper mapper nibble",
+			header: header(1, 1, 0x10, 0x41, 0, 0, 0, 0, 'D', 'i', 's', 'k'),
+			want:   RomInfo{Mapper: 1, PRGROMSize: 0x4000, CHRROMSize: 0x2000, PRGRAMSize: 0x2000},
+		},
+		{
+			name:   "iNES PAL",
+			header: header(1, 1, 0, 0, 0, 0x01),
+			want:   RomInfo{PRGROMSize: 0x4000, CHRROMSize: 0x2000, PRGRAMSize: 0x2000, Timing: TimingPAL},
+		},
+		{
+			name:   "NES 2.0 fields",
+			header: header(0x02, 0x01, 0x12, 0x4b, 0x21, 0x01, 0x70, 0x07, 0x03, 0x05, 0, 0x2a),
+			want: RomInfo{IsNES20: true, Mapper: 0x141, Submapper: 2, PRGROMSize: 0x102 * 0x4000, CHRROMSize: 0x2000,
+				PRGNVRAMSize: 0x2000, CHRRAMSize: 0x2000, Mirroring: MirrorHorizontal, HasBattery: true,
+				Timing: TimingDendy, Console: ConsoleExtended, ExtendedConsole: 5, ExpansionDevice: 0x2a},
+		},
+		{
+			name:   "NES 2.0 exponent sizes",
+			header: header(0x4d, 0x3c, 0, 0x08, 0, 0xff),
+			want:   RomInfo{IsNES20: true, PRGROMSize: 3 << 19, CHRROMSize: 1 << 15},
+		},
+	}
+	for _, tt := range tests {
+		info, err := ParseHeader(tt.header)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *info != tt.want {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, *info, tt.want)
+		}
+	}
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []uint8
+		err    string
+	}{
+		{"short", header(1, 1)[:10], "header is 10 bytes"},
+		{"signature", append([]uint8("NES\x00"), make([]uint8, 12)...), "missing iNES signature"},
+		{"no PRG-ROM", header(0, 1), "no PRG-ROM"},
+		{"NES 2.0 no PRG-ROM", header(0, 1, 0, 0x08), "no PRG-ROM"},
+		{"exponent too large", header(0xfc, 0, 0, 0x08, 0, 0x0f), "too large"},
+	}
+	for _, tt := range tests {
+		_, err := ParseHeader(tt.header)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestLoadTruncated(t *testing.T) {
+	nrom := header(1, 1)
+	trainer := header(1, 1, 0x04)
+	tests := []struct {
+		name string
+		data []uint8
+		err  string
+	}{
+		{"header", nrom[:8], "shorter than the 16-byte header"},
+		{"trainer", append(trainer, make([]uint8, 100)...), "trainer but image is truncated"},
+		{"PRG-ROM", append(nrom, make([]uint8, 0x3000)...), "bytes of PRG-ROM but only"},
+		{"CHR-ROM", append(nrom, make([]uint8, 0x5000)...), "bytes of CHR-ROM but only"},
+	}
+	for _, tt := range tests {
+		_, err := Load(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+//TestLoadTrainer はPRG-RAMが小さいと宣言されていてもトレーナーが $7000 に置かれるか
+func TestLoadTrainer(t *testing.T) {
+	for _, h := range [][]uint8{
+		header(1, 1, 0x04),
+		header(1, 1, 0x06),
+		//NES 2.0 でPRG-RAM 2KB
+		header(1, 1, 0x04, 0x08, 0, 0, 0x05),
+		//NES 2.0 でPRG-RAM無し
+		header(1, 1, 0x04, 0x08),
+	} {
+		data := append([]uint8{}, h...)
+		for i := 0; i < trainerSize; i++ {
+			data = append(data, uint8(i))
+		}
+		data = append(data, make([]uint8, 0x6000)...)
+		c, err := Load(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c.PRGRAM) < 0x2000 {
+			t.Errorf("% X: %d bytes of PRG-RAM", h[4:], len(c.PRGRAM))
+			continue
+		}
+		if c.ReadCPU(0x7000) != 0x00 || c.ReadCPU(0x71ff) != 0xff {
+			t.Errorf("% X: trainer not at $7000", h[4:])
+		}
+	}
+}
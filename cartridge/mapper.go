@@ -0,0 +1,68 @@
+package cartridge
+
+//Mapper はCPU/PPUから見たカートリッジ基板
+type Mapper interface {
+	//ReadCPU はCPU $4020-$FFFF の読み出し
+	ReadCPU(addr uint16) uint8
+	//WriteCPU はCPU $4020-$FFFF への書き込み
+	WriteCPU(addr uint16, data uint8)
+	//ReadPPU はPPU $0000-$1FFF の読み出し
+	ReadPPU(addr uint16) uint8
+	//WritePPU はPPU $0000-$1FFF への書き込み
+	WritePPU(addr uint16, data uint8)
+	//Mirroring は現在のネームテーブル配線
+	Mirroring() Mirroring
+	//IRQ はカートリッジのIRQ線がアサートされていればtrue
+	IRQ() bool
+	//Scanline はPPUが1ライン終えるごとに呼ばれる
+	Scanline()
+	//Step はCPU 1サイクルごとに呼ばれる
+	Step()
+}
+
+//board は各Mapperが埋め込む既定実装
+type board struct {
+	*Cartridge
+}
+
+//readPRGRAM は $6000-$7FFF のPRG-RAMを読む
+func (b *board) readPRGRAM(addr uint16) uint8 {
+	if len(b.PRGRAM) == 0 {
+		return 0x00
+	}
+	return b.PRGRAM[int(addr-0x6000)%len(b.PRGRAM)]
+}
+
+func (b *board) writePRGRAM(addr uint16, data uint8) {
+	if len(b.PRGRAM) > 0 {
+		b.PRGRAM[int(addr-0x6000)%len(b.PRGRAM)] = data
+	}
+}
+
+func (b *board) ReadPPU(addr uint16) uint8 {
+	return b.CHR[addr]
+}
+
+func (b *board) WritePPU(addr uint16, data uint8) {
+	if b.IsCHRRAM {
+		b.CHR[addr] = data
+	}
+}
+
+func (b *board) Mirroring() Mirroring {
+	return b.Mirror
+}
+
+func (b *board) IRQ() bool {
+	return false
+}
+
+func (b *board) Scanline() {}
+
+func (b *board) Step() {}
+
+func (b *board) stateFields() map[string]interface{} {
+	return nil
+}
+
+func (b *board) loadedState() {}
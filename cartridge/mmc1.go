@@ -0,0 +1,182 @@
+package cartridge
+
+//mmc1 Mapper 1 (SxROM)
+type mmc1 struct {
+	board
+	shift     uint8
+	control   uint8
+	chrBank0  uint8
+	chrBank1  uint8
+	prgBank   uint8
+	prgOffset [2]int
+	chrOffset [2]int
+	//連続サイクルの書き込みは無視される
+	cycle     int
+	lastWrite int
+}
+
+func newMMC1(c *Cartridge) *mmc1 {
+	m := &mmc1{board: board{c}}
+	m.shift = 0x10
+	m.control = 0x0c
+	m.lastWrite = -2
+	m.updateOffsets()
+	return m
+}
+
+func (m *mmc1) Step() {
+	m.cycle++
+}
+
+func (m *mmc1) stateFields() map[string]interface{} {
+	return map[string]interface{}{
+		"shift":     &m.shift,
+		"control":   &m.control,
+		"chrBank0":  &m.chrBank0,
+		"chrBank1":  &m.chrBank1,
+		"prgBank":   &m.prgBank,
+		"cycle":     &m.cycle,
+		"lastWrite": &m.lastWrite,
+	}
+}
+
+func (m *mmc1) loadedState() {
+	m.updateOffsets()
+}
+
+func (m *mmc1) ReadCPU(addr uint16) uint8 {
+	switch {
+	case addr >= 0x8000:
+		bank := (addr - 0x8000) / 0x4000
+		return m.PRG[m.prgOffset[bank]+int(addr%0x4000)]
+	case addr >= 0x6000:
+		if m.isRAMEnabled() {
+			return m.PRGRAM[(m.ramOffset()+int(addr-0x6000))%len(m.PRGRAM)]
+		}
+	}
+	return 0x00
+}
+
+func (m *mmc1) WriteCPU(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x8000:
+		m.writeShift(addr, data)
+	case addr >= 0x6000:
+		if m.isRAMEnabled() {
+			m.PRGRAM[(m.ramOffset()+int(addr-0x6000))%len(m.PRGRAM)] = data
+		}
+	}
+}
+
+func (m *mmc1) ReadPPU(addr uint16) uint8 {
+	bank := addr / 0x1000
+	return m.CHR[m.chrOffset[bank]+int(addr%0x1000)]
+}
+
+func (m *mmc1) WritePPU(addr uint16, data uint8) {
+	if m.IsCHRRAM {
+		bank := addr / 0x1000
+		m.CHR[m.chrOffset[bank]+int(addr%0x1000)] = data
+	}
+}
+
+func (m *mmc1) Mirroring() Mirroring {
+	switch m.control & 0x03 {
+	case 0x00:
+		return MirrorSingleLower
+	case 0x01:
+		return MirrorSingleUpper
+	case 0x02:
+		return MirrorVertical
+	}
+	return MirrorHorizontal
+}
+
+//writeShift は5bitシフトレジスタへ1bit書き込む
+func (m *mmc1) writeShift(addr uint16, data uint8) {
+	isConsecutive := m.cycle == m.lastWrite+1
+	m.lastWrite = m.cycle
+	if data&0x80 != 0x00 {
+		m.shift = 0x10
+		m.control |= 0x0c
+		m.updateOffsets()
+		return
+	}
+	if isConsecutive {
+		return
+	}
+	isFull := m.shift&0x01 != 0x00
+	m.shift = (m.shift >> 1) | ((data & 0x01) << 4)
+	if isFull {
+		m.writeRegister(addr, m.shift)
+		m.shift = 0x10
+	}
+}
+
+func (m *mmc1) writeRegister(addr uint16, data uint8) {
+	switch {
+	case addr < 0xa000:
+		m.control = data
+	case addr < 0xc000:
+		m.chrBank0 = data
+	case addr < 0xe000:
+		m.chrBank1 = data
+	default:
+		m.prgBank = data
+	}
+	m.updateOffsets()
+}
+
+//isRAMEnabled PRG bank の bit4 が0ならPRG-RAM有効
+func (m *mmc1) isRAMEnabled() bool {
+	return len(m.PRGRAM) > 0 && m.prgBank&0x10 == 0x00
+}
+
+//ramOffset はPRG-RAMのバンク．SOROM (16KB) はCHR bank の bit3，SXROM (32KB) は bit2-3 で切り替える
+func (m *mmc1) ramOffset() int {
+	switch len(m.PRGRAM) / 0x2000 {
+	case 2:
+		return int((m.chrBank0>>3)&0x01) * 0x2000
+	case 4:
+		return int((m.chrBank0>>2)&0x03) * 0x2000
+	}
+	return 0
+}
+
+func (m *mmc1) updateOffsets() {
+	//SUROM/SXROM は CHR bank の bit4 でPRG 256KBの上下を切り替える
+	outer := 0
+	if len(m.PRG) > 0x40000 {
+		outer = int(m.chrBank0&0x10) * 0x4000
+	}
+	bank := int(m.prgBank & 0x0f)
+	lastBank := len(m.PRG)/0x4000 - 1
+	if lastBank > 0x0f {
+		lastBank = 0x0f
+	}
+	switch (m.control >> 2) & 0x03 {
+	case 0x00, 0x01:
+		m.prgOffset[0] = outer + (bank&0x0e)*0x4000
+		m.prgOffset[1] = outer + (bank|0x01)*0x4000
+	case 0x02:
+		m.prgOffset[0] = outer
+		m.prgOffset[1] = outer + bank*0x4000
+	case 0x03:
+		m.prgOffset[0] = outer + bank*0x4000
+		m.prgOffset[1] = outer + lastBank*0x4000
+	}
+	for i := range m.prgOffset {
+		m.prgOffset[i] %= len(m.PRG)
+	}
+
+	if m.control&0x10 == 0x00 {
+		m.chrOffset[0] = int(m.chrBank0&0x1e) * 0x1000
+		m.chrOffset[1] = int(m.chrBank0|0x01) * 0x1000
+	} else {
+		m.chrOffset[0] = int(m.chrBank0) * 0x1000
+		m.chrOffset[1] = int(m.chrBank1) * 0x1000
+	}
+	for i := range m.chrOffset {
+		m.chrOffset[i] %= len(m.CHR)
+	}
+}
@@ -0,0 +1,43 @@
+package cartridge
+
+import "testing"
+
+//writeMMC1 はシリアルポート経由で MMC1 のレジスタに書く
+func writeMMC1(c *Cartridge, addr uint16, data uint8) {
+	for i := uint(0); i < 5; i++ {
+		c.Step()
+		c.Step()
+		c.WriteCPU(addr, data>>i&0x01)
+	}
+}
+
+func TestMMC1RAMBank(t *testing.T) {
+	tests := []struct {
+		name    string
+		ramSize int
+		chrBank uint8
+		offset  int
+	}{
+		{"SNROM", 0x2000, 0x0c, 0x0000},
+		{"SOROM bit2 ignored", 0x4000, 0x04, 0x0000},
+		{"SOROM bit3", 0x4000, 0x08, 0x2000},
+		{"SXROM bank1", 0x8000, 0x04, 0x2000},
+		{"SXROM bank2", 0x8000, 0x08, 0x4000},
+		{"SXROM bank3", 0x8000, 0x0c, 0x6000},
+	}
+	for _, tt := range tests {
+		info := &RomInfo{Mapper: 1, PRGROMSize: 0x8000, PRGNVRAMSize: tt.ramSize, HasBattery: true}
+		c, err := New(info, make([]uint8, 0x8000), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeMMC1(c, 0xa000, tt.chrBank)
+		c.WriteCPU(0x6123, 0xa5)
+		if got := c.PRGRAM[tt.offset+0x123]; got != 0xa5 {
+			t.Errorf("%s: PRG-RAM[$%04X] = $%02X, want $A5", tt.name, tt.offset+0x123, got)
+		}
+		if got := c.ReadCPU(0x6123); got != 0xa5 {
+			t.Errorf("%s: read back $%02X", tt.name, got)
+		}
+	}
+}
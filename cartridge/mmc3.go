@@ -0,0 +1,207 @@
+package cartridge
+
+//mmc3 Mapper 4 (TxROM)
+type mmc3 struct {
+	board
+	bankSelect uint8
+	registers  [8]uint8
+	prgOffset  [4]int
+	chrOffset  [8]int
+	mirror     Mirroring
+	isRAMOn    bool
+	isRAMWrite bool
+	//IRQ
+	irqLatch   uint8
+	irqCounter uint8
+	isReload   bool
+	isIRQOn    bool
+	isIRQ      bool
+	//A12 の立ち上がり検出．M2 で数サイクル Low が続いたものだけ数える
+	isA12High bool
+	a12Low    int
+}
+
+func newMMC3(c *Cartridge) *mmc3 {
+	m := &mmc3{board: board{c}}
+	m.mirror = c.Mirror
+	m.isRAMOn = true
+	m.isRAMWrite = true
+	m.updateOffsets()
+	return m
+}
+
+func (m *mmc3) Step() {
+	if !m.isA12High {
+		m.a12Low++
+	}
+}
+
+func (m *mmc3) stateFields() map[string]interface{} {
+	return map[string]interface{}{
+		"bankSelect": &m.bankSelect,
+		"registers":  &m.registers,
+		"mirror":     &m.mirror,
+		"isRAMOn":    &m.isRAMOn,
+		"isRAMWrite": &m.isRAMWrite,
+		"irqLatch":   &m.irqLatch,
+		"irqCounter": &m.irqCounter,
+		"isReload":   &m.isReload,
+		"isIRQOn":    &m.isIRQOn,
+		"isIRQ":      &m.isIRQ,
+		"isA12High":  &m.isA12High,
+		"a12Low":     &m.a12Low,
+	}
+}
+
+func (m *mmc3) loadedState() {
+	m.updateOffsets()
+}
+
+func (m *mmc3) ReadCPU(addr uint16) uint8 {
+	switch {
+	case addr >= 0x8000:
+		bank := (addr - 0x8000) / 0x2000
+		return m.PRG[m.prgOffset[bank]+int(addr%0x2000)]
+	case addr >= 0x6000:
+		if m.isRAMOn {
+			return m.readPRGRAM(addr)
+		}
+	}
+	return 0x00
+}
+
+func (m *mmc3) WriteCPU(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x8000:
+		m.writeRegister(addr, data)
+	case addr >= 0x6000:
+		if m.isRAMOn && m.isRAMWrite {
+			m.writePRGRAM(addr, data)
+		}
+	}
+}
+
+func (m *mmc3) ReadPPU(addr uint16) uint8 {
+	m.watchA12(addr)
+	bank := addr / 0x0400
+	return m.CHR[m.chrOffset[bank]+int(addr%0x0400)]
+}
+
+func (m *mmc3) WritePPU(addr uint16, data uint8) {
+	m.watchA12(addr)
+	if m.IsCHRRAM {
+		bank := addr / 0x0400
+		m.CHR[m.chrOffset[bank]+int(addr%0x0400)] = data
+	}
+}
+
+func (m *mmc3) Mirroring() Mirroring {
+	return m.mirror
+}
+
+func (m *mmc3) IRQ() bool {
+	return m.isIRQ
+}
+
+func (m *mmc3) writeRegister(addr uint16, data uint8) {
+	isEven := addr%2 == 0
+	switch {
+	case addr < 0xa000:
+		if isEven {
+			m.bankSelect = data
+		} else {
+			m.registers[m.bankSelect&0x07] = data
+		}
+		m.updateOffsets()
+	case addr < 0xc000:
+		if isEven {
+			if m.Mirror != MirrorFourScreen {
+				if data&0x01 == 0x00 {
+					m.mirror = MirrorVertical
+				} else {
+					m.mirror = MirrorHorizontal
+				}
+			}
+		} else {
+			m.isRAMOn = data&0x80 != 0x00
+			m.isRAMWrite = data&0x40 == 0x00
+		}
+	case addr < 0xe000:
+		if isEven {
+			m.irqLatch = data
+		} else {
+			m.irqCounter = 0
+			m.isReload = true
+		}
+	default:
+		if isEven {
+			m.isIRQOn = false
+			m.isIRQ = false
+		} else {
+			m.isIRQOn = true
+		}
+	}
+}
+
+//watchA12 はPPUアドレスバスの A12 を監視してスキャンラインカウンタを進める
+func (m *mmc3) watchA12(addr uint16) {
+	isHigh := addr&0x1000 != 0x0000
+	if isHigh && !m.isA12High && m.a12Low >= 3 {
+		m.clockCounter()
+	}
+	if !isHigh && m.isA12High {
+		m.a12Low = 0
+	}
+	m.isA12High = isHigh
+}
+
+func (m *mmc3) clockCounter() {
+	before := m.irqCounter
+	isReload := m.isReload
+	if m.irqCounter == 0 || m.isReload {
+		m.irqCounter = m.irqLatch
+		m.isReload = false
+	} else {
+		m.irqCounter--
+	}
+	if m.irqCounter != 0 || !m.isIRQOn {
+		return
+	}
+	//Rev A は 0 からの再ロードではIRQを出さない
+	if m.MMC3RevA && before == 0 && !isReload {
+		return
+	}
+	m.isIRQ = true
+}
+
+func (m *mmc3) updateOffsets() {
+	prgBanks := len(m.PRG) / 0x2000
+	secondLast := (prgBanks - 2) * 0x2000
+	if m.bankSelect&0x40 == 0x00 {
+		m.prgOffset[0] = int(m.registers[6]) % prgBanks * 0x2000
+		m.prgOffset[2] = secondLast
+	} else {
+		m.prgOffset[0] = secondLast
+		m.prgOffset[2] = int(m.registers[6]) % prgBanks * 0x2000
+	}
+	m.prgOffset[1] = int(m.registers[7]) % prgBanks * 0x2000
+	m.prgOffset[3] = (prgBanks - 1) * 0x2000
+
+	chrBanks := len(m.CHR) / 0x0400
+	var banks [8]int
+	banks[0] = int(m.registers[0] & 0xfe)
+	banks[1] = int(m.registers[0] | 0x01)
+	banks[2] = int(m.registers[1] & 0xfe)
+	banks[3] = int(m.registers[1] | 0x01)
+	for i := 0; i < 4; i++ {
+		banks[4+i] = int(m.registers[2+i])
+	}
+	for i := range banks {
+		//CHR A12 反転
+		slot := i
+		if m.bankSelect&0x80 != 0x00 {
+			slot = i ^ 0x04
+		}
+		m.chrOffset[slot] = banks[i] % chrBanks * 0x0400
+	}
+}
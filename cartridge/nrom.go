@@ -0,0 +1,27 @@
+package cartridge
+
+//nrom Mapper 0
+type nrom struct {
+	board
+}
+
+func newNROM(c *Cartridge) *nrom {
+	return &nrom{board{c}}
+}
+
+func (m *nrom) ReadCPU(addr uint16) uint8 {
+	switch {
+	case addr >= 0x8000:
+		//16KBの場合は $C000- がミラー
+		return m.PRG[int(addr-0x8000)%len(m.PRG)]
+	case addr >= 0x6000:
+		return m.readPRGRAM(addr)
+	}
+	return 0x00
+}
+
+func (m *nrom) WriteCPU(addr uint16, data uint8) {
+	if addr >= 0x6000 && addr < 0x8000 {
+		m.writePRGRAM(addr, data)
+	}
+}
@@ -0,0 +1,95 @@
+package cartridge
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+)
+
+//State はセーブステートに書き出すカートリッジの状態
+type State struct {
+	Mapper int
+	PRGRAM []uint8
+	//CHRRAM はCHR-RAMの基板だけ
+	CHRRAM []uint8
+	//Registers は基板のレジスタ．名前ごとに gob で符号化するので，
+	//レジスタが増減しても知っている名前だけ読める
+	Registers map[string][]byte
+}
+
+//stater は各Mapperが実装する．セーブステートに含めるレジスタを名前とポインタで返す
+type stater interface {
+	stateFields() map[string]interface{}
+	//loadedState はレジスタを戻した後に呼ばれ，バンクのオフセットなどを計算し直す
+	loadedState()
+}
+
+//Checksum はPRG/CHR-ROMのCRC32．別のゲームのステートを読まないために使う
+func (c *Cartridge) Checksum() uint32 {
+	h := crc32.NewIEEE()
+	h.Write(c.PRG)
+	if !c.IsCHRRAM {
+		h.Write(c.CHR)
+	}
+	return h.Sum32()
+}
+
+//SaveState は現在の状態を返す
+func (c *Cartridge) SaveState() (State, error) {
+	s := State{
+		Mapper:    c.Info.Mapper,
+		PRGRAM:    append([]uint8{}, c.PRGRAM...),
+		Registers: map[string][]byte{},
+	}
+	if c.IsCHRRAM {
+		s.CHRRAM = append([]uint8{}, c.CHR...)
+	}
+	for name, field := range c.Mapper.(stater).stateFields() {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(field); err != nil {
+			return State{}, fmt.Errorf("cartridge: state %s: %v", name, err)
+		}
+		s.Registers[name] = buf.Bytes()
+	}
+	return s, nil
+}
+
+//LoadState は SaveState で取った状態に戻す．形が合わなければ何も変えない
+func (c *Cartridge) LoadState(s State) error {
+	if s.Mapper != c.Info.Mapper {
+		return fmt.Errorf("cartridge: state is for mapper %d, not %d", s.Mapper, c.Info.Mapper)
+	}
+	if len(s.PRGRAM) != len(c.PRGRAM) {
+		return fmt.Errorf("cartridge: state has %d bytes of PRG-RAM, expected %d", len(s.PRGRAM), len(c.PRGRAM))
+	}
+	if c.IsCHRRAM && len(s.CHRRAM) != len(c.CHR) {
+		return fmt.Errorf("cartridge: state has %d bytes of CHR-RAM, expected %d", len(s.CHRRAM), len(c.CHR))
+	}
+	//レジスタは一旦コピーに読んでから反映する
+	m := c.Mapper.(stater)
+	fields := m.stateFields()
+	decoded := map[string]reflect.Value{}
+	for name, field := range fields {
+		data, ok := s.Registers[name]
+		if !ok {
+			continue
+		}
+		v := reflect.New(reflect.TypeOf(field).Elem())
+		if err := gob.NewDecoder(bytes.NewReader(data)).DecodeValue(v); err != nil {
+			return fmt.Errorf("cartridge: state %s: %v", name, err)
+		}
+		decoded[name] = v
+	}
+
+	copy(c.PRGRAM, s.PRGRAM)
+	if c.IsCHRRAM {
+		copy(c.CHR, s.CHRRAM)
+	}
+	for name, v := range decoded {
+		reflect.ValueOf(fields[name]).Elem().Set(v.Elem())
+	}
+	m.loadedState()
+	return nil
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/pishiko/gones/input"
+)
+
+//buttonNames 設定ファイルでのボタン名．添字は input.Button
+var buttonNames = [8]string{"A", "B", "Select", "Start", "Up", "Down", "Left", "Right"}
+
+//Config は設定ファイル (ユーザ設定ディレクトリの gones/config.json)
+type Config struct {
+	Players [2]PlayerConfig `json:"players"`
+	Macros  []MacroConfig   `json:"macros"`
+}
+
+//PlayerConfig はプレイヤーごとの割り当て．キーはボタン名
+type PlayerConfig struct {
+	//Keys はキーボードのキー名 ("L", "Space", "Up" など)
+	Keys map[string][]string `json:"keys"`
+	//Turbo は押している間連射するキー．TurboRate は1秒あたりの回数 (0なら既定値)
+	Turbo     map[string][]string `json:"turbo"`
+	TurboRate int                 `json:"turboRate"`
+	Gamepad   GamepadConfig       `json:"gamepad"`
+}
+
+//GamepadConfig はゲームパッドの割り当て
+type GamepadConfig struct {
+	//Index はつながった順で何番目のゲームパッドを使うか．負なら使わない
+	Index   int                     `json:"index"`
+	Buttons map[string][]int        `json:"buttons"`
+	Turbo   map[string][]int        `json:"turbo"`
+	Axes    map[string][]AxisConfig `json:"axes"`
+	//Deadzone より小さい軸の傾きは無視する (0-1)
+	Deadzone float64 `json:"deadzone"`
+}
+
+//AxisConfig は軸を Direction (1 か -1) の向きに倒したときボタンを押したことにする
+type AxisConfig struct {
+	Axis      int `json:"axis"`
+	Direction int `json:"direction"`
+}
+
+//MacroConfig は Key を押すと Player (1か2) のボタンを Steps の順に押すマクロ．
+//Loop なら止める(もう一度押す)まで繰り返す
+type MacroConfig struct {
+	Key    string            `json:"key"`
+	Player int               `json:"player"`
+	Loop   bool              `json:"loop"`
+	Steps  []MacroStepConfig `json:"steps"`
+}
+
+//MacroStepConfig は Buttons を Frames フレーム押す
+type MacroStepConfig struct {
+	Buttons []string `json:"buttons"`
+	Frames  int      `json:"frames"`
+}
+
+//defaultTurboRate 連射の既定の速さ (Hz)
+const defaultTurboRate = 15
+
+//DefaultConfig は設定ファイルが無いときの割り当て．
+//ゲームパッドは XInput 系の並び (右側の2つがB,A，左上の2つが連射，Back/Start，十字キーは軸と10-13番)
+func DefaultConfig() *Config {
+	gamepad := func(index int) GamepadConfig {
+		return GamepadConfig{
+			Index: index,
+			Buttons: map[string][]int{
+				"A": {1}, "B": {0}, "Select": {6}, "Start": {7},
+				"Up": {10}, "Right": {11}, "Down": {12}, "Left": {13},
+			},
+			Turbo: map[string][]int{"A": {3}, "B": {2}},
+			Axes: map[string][]AxisConfig{
+				"Up":    {{Axis: 1, Direction: -1}},
+				"Down":  {{Axis: 1, Direction: 1}},
+				"Left":  {{Axis: 0, Direction: -1}},
+				"Right": {{Axis: 0, Direction: 1}},
+			},
+			Deadzone: 0.5,
+		}
+	}
+	return &Config{Players: [2]PlayerConfig{
+		{
+			Keys: map[string][]string{
+				"A": {"L"}, "B": {"K"}, "Select": {"O"}, "Start": {"P"},
+				"Up": {"W"}, "Down": {"S"}, "Left": {"A"}, "Right": {"D"},
+			},
+			Turbo:     map[string][]string{"A": {"Semicolon"}, "B": {"J"}},
+			TurboRate: defaultTurboRate,
+			Gamepad:   gamepad(0),
+		},
+		{
+			Keys: map[string][]string{
+				"A": {"Period"}, "B": {"Comma"}, "Select": {"M"}, "Start": {"Enter"},
+				"Up": {"Up"}, "Down": {"Down"}, "Left": {"Left"}, "Right": {"Right"},
+			},
+			TurboRate: defaultTurboRate,
+			Gamepad:   gamepad(1),
+		},
+	}}
+}
+
+//ConfigPath はユーザ設定ディレクトリの gones/config.json
+func ConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gones", "config.json"), nil
+}
+
+//LoadConfig は path を読む．無ければ既定の設定を書き出して使う．
+//書いていないプレイヤーやボタンは既定の割り当てのまま
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		config := DefaultConfig()
+		return config, config.Save(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	//配列のままだと足りないプレイヤーが空になるので，1人ずつ既定値に重ねる
+	var file struct {
+		Players []json.RawMessage `json:"players"`
+		Macros  []MacroConfig     `json:"macros"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+	config := DefaultConfig()
+	if len(file.Players) > len(config.Players) {
+		return nil, fmt.Errorf("config: %s: %d players, at most %d", path, len(file.Players), len(config.Players))
+	}
+	for i, player := range file.Players {
+		if err := json.Unmarshal(player, &config.Players[i]); err != nil {
+			return nil, fmt.Errorf("config: %s: player %d: %v", path, i+1, err)
+		}
+	}
+	config.Macros = file.Macros
+	return config, nil
+}
+
+//Save は path に書き出す
+func (c *Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0666)
+}
+
+//binding は設定を ebiten のキー・ボタンに解決した1プレイヤー分の割り当て
+type binding struct {
+	keys         [8][]ebiten.Key
+	turboKeys    [8][]ebiten.Key
+	turbo        *input.Turbo
+	gamepadIndex int
+	buttons      [8][]ebiten.GamepadButton
+	turboButtons [8][]ebiten.GamepadButton
+	axes         [8][]AxisConfig
+	deadzone     float64
+}
+
+//macroBinding はキーに割り当てたマクロ
+type macroBinding struct {
+	key    ebiten.Key
+	player int
+	macro  *input.Macro
+}
+
+//bindings は設定を解決する．知らない名前があればエラー
+func (c *Config) bindings() ([2]binding, error) {
+	var b [2]binding
+	for p, player := range c.Players {
+		var err error
+		if b[p].keys, err = resolveKeys(player.Keys); err != nil {
+			return b, fmt.Errorf("config: player %d: %v", p+1, err)
+		}
+		if b[p].turboKeys, err = resolveKeys(player.Turbo); err != nil {
+			return b, fmt.Errorf("config: player %d: turbo: %v", p+1, err)
+		}
+		rate := player.TurboRate
+		if rate == 0 {
+			rate = defaultTurboRate
+		}
+		if b[p].turbo, err = input.NewTurbo(rate); err != nil {
+			return b, fmt.Errorf("config: player %d: %v", p+1, err)
+		}
+		b[p].gamepadIndex = player.Gamepad.Index
+		b[p].deadzone = player.Gamepad.Deadzone
+		if b[p].buttons, err = resolveGamepadButtons(player.Gamepad.Buttons); err != nil {
+			return b, fmt.Errorf("config: player %d: %v", p+1, err)
+		}
+		if b[p].turboButtons, err = resolveGamepadButtons(player.Gamepad.Turbo); err != nil {
+			return b, fmt.Errorf("config: player %d: turbo: %v", p+1, err)
+		}
+		for name, axes := range player.Gamepad.Axes {
+			button, err := buttonByName(name)
+			if err != nil {
+				return b, fmt.Errorf("config: player %d: %v", p+1, err)
+			}
+			for _, axis := range axes {
+				if axis.Axis < 0 || (axis.Direction != 1 && axis.Direction != -1) {
+					return b, fmt.Errorf("config: player %d: axis %d direction %d for %s is invalid", p+1, axis.Axis, axis.Direction, name)
+				}
+			}
+			b[p].axes[button] = axes
+		}
+	}
+	return b, nil
+}
+
+//macros はマクロの設定を解決する
+func (c *Config) macros() ([]macroBinding, error) {
+	var macros []macroBinding
+	for i, m := range c.Macros {
+		key, ok := keyByName(m.Key)
+		if !ok {
+			return nil, fmt.Errorf("config: macro %d: unknown key %q", i+1, m.Key)
+		}
+		if m.Player != 1 && m.Player != 2 {
+			return nil, fmt.Errorf("config: macro %d: player must be 1 or 2, not %d", i+1, m.Player)
+		}
+		var steps []input.MacroStep
+		frames := 0
+		for _, step := range m.Steps {
+			if step.Frames < 0 {
+				return nil, fmt.Errorf("config: macro %d: negative frame count %d", i+1, step.Frames)
+			}
+			frames += step.Frames
+			s := input.MacroStep{Frames: step.Frames}
+			for _, name := range step.Buttons {
+				button, err := buttonByName(name)
+				if err != nil {
+					return nil, fmt.Errorf("config: macro %d: %v", i+1, err)
+				}
+				s.Buttons[button] = true
+			}
+			steps = append(steps, s)
+		}
+		//押す段が1つもないマクロは再生できない
+		if frames == 0 {
+			return nil, fmt.Errorf("config: macro %d: no steps with a positive frame count", i+1)
+		}
+		macros = append(macros, macroBinding{key: key, player: m.Player - 1, macro: input.NewMacro(steps, m.Loop)})
+	}
+	return macros, nil
+}
+
+//resolveKeys はボタン名からキー名への割り当てを解決する
+func resolveKeys(names map[string][]string) ([8][]ebiten.Key, error) {
+	var keys [8][]ebiten.Key
+	for name, list := range names {
+		button, err := buttonByName(name)
+		if err != nil {
+			return keys, err
+		}
+		for _, k := range list {
+			key, ok := keyByName(k)
+			if !ok {
+				return keys, fmt.Errorf("unknown key %q for %s", k, name)
+			}
+			keys[button] = append(keys[button], key)
+		}
+	}
+	return keys, nil
+}
+
+//resolveGamepadButtons はボタン名からゲームパッドのボタン番号への割り当てを解決する
+func resolveGamepadButtons(numbers map[string][]int) ([8][]ebiten.GamepadButton, error) {
+	var buttons [8][]ebiten.GamepadButton
+	for name, list := range numbers {
+		button, err := buttonByName(name)
+		if err != nil {
+			return buttons, err
+		}
+		for _, gb := range list {
+			if gb < 0 || gb > int(ebiten.GamepadButtonMax) {
+				return buttons, fmt.Errorf("gamepad button %d for %s is out of range", gb, name)
+			}
+			buttons[button] = append(buttons[button], ebiten.GamepadButton(gb))
+		}
+	}
+	return buttons, nil
+}
+
+func buttonByName(name string) (input.Button, error) {
+	for i, n := range buttonNames {
+		if strings.EqualFold(n, name) {
+			return input.Button(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown button %q (want one of %s)", name, strings.Join(buttonNames[:], ", "))
+}
+
+//keyByName は ebiten.Key.String() の名前を大文字小文字を区別せずに探す
+func keyByName(name string) (ebiten.Key, bool) {
+	for k := ebiten.Key(0); k <= ebiten.KeyMax; k++ {
+		if strings.EqualFold(k.String(), name) {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+//read は frame で押されているボタンを返す．hasGamepad が false ならキーボードだけ見る
+func (b *binding) read(gamepad ebiten.GamepadID, hasGamepad bool, frame int) input.Buttons {
+	var buttons input.Buttons
+	isTurboOn := b.turbo.Pressed(frame)
+	for i := range buttons {
+		for _, key := range b.keys[i] {
+			buttons[i] = buttons[i] || ebiten.IsKeyPressed(key)
+		}
+		for _, key := range b.turboKeys[i] {
+			buttons[i] = buttons[i] || isTurboOn && ebiten.IsKeyPressed(key)
+		}
+		if !hasGamepad {
+			continue
+		}
+		for _, gb := range b.buttons[i] {
+			buttons[i] = buttons[i] || ebiten.IsGamepadButtonPressed(gamepad, gb)
+		}
+		for _, gb := range b.turboButtons[i] {
+			buttons[i] = buttons[i] || isTurboOn && ebiten.IsGamepadButtonPressed(gamepad, gb)
+		}
+		for _, axis := range b.axes[i] {
+			if axis.Axis >= ebiten.GamepadAxisNum(gamepad) {
+				continue
+			}
+			v := ebiten.GamepadAxis(gamepad, axis.Axis) * float64(axis.Direction)
+			buttons[i] = buttons[i] || v > b.deadzone
+		}
+	}
+	return buttons
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//TestLoadPartialConfig は書いていないプレイヤーやボタンが既定値のまま残るか
+func TestLoadPartialConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	data := `{"players": [{"keys": {"A": ["Z"]}, "gamepad": {"deadzone": 0.25}}]}`
+	if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := DefaultConfig()
+	p1 := config.Players[0]
+	if got := p1.Keys["A"]; !reflect.DeepEqual(got, []string{"Z"}) {
+		t.Errorf("player 1 A = %v, want [Z]", got)
+	}
+	if got := p1.Keys["B"]; !reflect.DeepEqual(got, def.Players[0].Keys["B"]) {
+		t.Errorf("player 1 B = %v, want default %v", got, def.Players[0].Keys["B"])
+	}
+	if p1.Gamepad.Deadzone != 0.25 || p1.Gamepad.Index != 0 {
+		t.Errorf("player 1 gamepad = index %d deadzone %v", p1.Gamepad.Index, p1.Gamepad.Deadzone)
+	}
+	if !reflect.DeepEqual(p1.Turbo, def.Players[0].Turbo) || p1.TurboRate != defaultTurboRate {
+		t.Errorf("player 1 turbo = %v at %d Hz", p1.Turbo, p1.TurboRate)
+	}
+	if !reflect.DeepEqual(config.Players[1], def.Players[1]) {
+		t.Errorf("player 2 = %+v, want defaults", config.Players[1])
+	}
+	if _, err := config.bindings(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, data := range []string{
+		`{"players": [{}, {}, {}]}`,
+		`{"players": [{"keys": {"A": "L"}}]}`,
+		`{"players": `,
+	} {
+		path := filepath.Join(dir, "config.json")
+		if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("%s: no error", data)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package console
+
+import (
+	"image"
+
+	"github.com/pishiko/gones/apu"
+	"github.com/pishiko/gones/cartridge"
+	"github.com/pishiko/gones/cpu"
+	"github.com/pishiko/gones/input"
+	"github.com/pishiko/gones/ppu"
+)
+
+//Console は画面や音声デバイスを持たないエミュレーション本体．
+//フロントエンドは Frame と Samples を読み出して出力する
+type Console struct {
+	Cartridge *cartridge.Cartridge
+	CPU       *cpu.CPU
+	PPU       *ppu.PPU
+	APU       *apu.APU
+	//Input はコントローラ端子．既定では両方に標準コントローラがつながっている
+	Input *input.Ports
+}
+
+//New はカートリッジを挿して電源を入れた状態を作る
+func New(cart *cartridge.Cartridge) *Console {
+	c := &Console{Cartridge: cart}
+	c.PPU = ppu.NewPPU(cart)
+	c.APU = apu.NewAPU(cart)
+	c.Input = input.NewPorts()
+	c.CPU = cpu.NewCPU(cart, c.PPU, c.APU, c.Input)
+	return c
+}
+
+//Step は標準コントローラのボタンを pads にして1命令実行し，1画面が完成したらtrueを返す．
+//PPU/APU はCPUのバスアクセスごとに進む
+func (c *Console) Step(pads [2]input.Buttons) bool {
+	c.Input.SetButtons(pads)
+	frame := c.PPU.FrameCount
+	c.CPU.Run()
+	return c.PPU.FrameCount != frame
+}
+
+//StepFrame は1画面分エミュレーションを進める
+func (c *Console) StepFrame(pads [2]input.Buttons) {
+	for !c.Step(pads) {
+	}
+}
+
+//Reset はリセットボタン．CPUはリセットの手順を踏み，APUは全チャンネルを止める
+func (c *Console) Reset() {
+	c.APU.Write(0x4015, 0x00)
+	c.CPU.RESET()
+}
+
+//Frame は最後に完成した 256x240 の画面
+func (c *Console) Frame() *image.RGBA {
+	return c.PPU.Frame()
+}
+
+//Screen は最後に完成した画面のパレット番号
+func (c *Console) Screen() *[ppu.ScreenWidth * ppu.ScreenHeight]uint8 {
+	return &c.PPU.Screen
+}
+
+//Samples は前回から溜まったPCM(モノラル16bit，APU.SetSampleRate の周波数)
+func (c *Console) Samples() []int16 {
+	return c.APU.Samples()
+}
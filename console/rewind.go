@@ -0,0 +1,282 @@
+package console
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pishiko/gones/input"
+	"github.com/pishiko/gones/ppu"
+)
+
+//inputSize 1フレーム分のキー入力として数えるバイト数
+const inputSize = 16
+
+//Rewinder は interval フレームごとにマシン全体のスナップショットを取り，1フレームずつ巻き戻せるようにする．
+//最新のスナップショットだけ展開したまま持ち，それより古いものは1つ新しいものとの XOR を flate で
+//圧縮して持つ．巻き戻すときは新しい方から順に展開し，間のフレームは記録したキー入力で作り直す
+type Rewinder struct {
+	console  *Console
+	interval int
+	//budget はスナップショットとキー入力に使うバイト数の上限．超えたら古いものから捨てる
+	budget int
+	size   int
+	//snapshots は古い順．最後の要素の状態は latest に展開してある
+	snapshots []*snapshot
+	latest    []byte
+	//isCut が立っていると次のフレームの前に必ずスナップショットを取る
+	isCut bool
+	//巻き戻し中は最後のスナップショットから shown フレーム進めた画面を出している
+	isRewinding bool
+	shown       int
+	screens     [][ppu.ScreenWidth * ppu.ScreenHeight]uint8
+}
+
+type snapshot struct {
+	//delta は1つ新しいスナップショットとの XOR を圧縮したもの．最新のものは nil
+	delta []byte
+	//inputs はこのスナップショットから進めた各フレームのキー入力
+	inputs [][2]input.Buttons
+}
+
+//NewRewinder は c を interval フレームごとに記録し，budget バイトまで溜める
+func NewRewinder(c *Console, interval, budget int) *Rewinder {
+	if interval < 1 {
+		interval = 1
+	}
+	return &Rewinder{console: c, interval: interval, budget: budget}
+}
+
+//StepFrame は記録しながら1画面分進める．巻き戻し中なら表示していたフレームから再開する
+func (r *Rewinder) StepFrame(pads [2]input.Buttons) error {
+	if r.isRewinding {
+		if err := r.resume(); err != nil {
+			return err
+		}
+	}
+	last := r.last()
+	if last == nil || len(last.inputs) >= r.interval || r.isCut {
+		if err := r.push(); err != nil {
+			return err
+		}
+		last = r.last()
+	}
+	last.inputs = append(last.inputs, pads)
+	r.size += inputSize
+	r.console.StepFrame(pads)
+	r.evict()
+	return nil
+}
+
+//Rewind は1フレーム前の状態を表示する．記録の一番古いところまで戻っていれば false
+func (r *Rewinder) Rewind() (bool, error) {
+	if len(r.snapshots) == 0 {
+		return false, nil
+	}
+	if !r.isRewinding {
+		if err := r.replay(); err != nil {
+			return false, err
+		}
+		r.isRewinding = true
+	}
+	if r.shown > 1 {
+		r.shown--
+	} else {
+		//このスナップショットの直前のフレームは1つ古いスナップショットから作る
+		if len(r.snapshots) == 1 {
+			return false, nil
+		}
+		if err := r.pop(); err != nil {
+			return false, err
+		}
+		if err := r.replay(); err != nil {
+			return false, err
+		}
+	}
+	r.console.PPU.Screen = r.screens[r.shown-1]
+	return true, nil
+}
+
+//Cut はステートのロードなどで流れが途切れたときに呼ぶ．巻き戻し中ならその位置で記録を切る
+func (r *Rewinder) Cut() {
+	if r.isRewinding {
+		r.truncate()
+	}
+	r.isCut = true
+}
+
+//Size はいま記録に使っているバイト数
+func (r *Rewinder) Size() int {
+	return r.size
+}
+
+func (r *Rewinder) last() *snapshot {
+	if len(r.snapshots) == 0 {
+		return nil
+	}
+	return r.snapshots[len(r.snapshots)-1]
+}
+
+//push は現在の状態を最新のスナップショットにし，それまでの最新を差分にする
+func (r *Rewinder) push() error {
+	s, err := r.console.state()
+	if err != nil {
+		return err
+	}
+	raw, err := r.encode(s)
+	if err != nil {
+		return err
+	}
+	if last := r.last(); last != nil {
+		d := append([]byte{}, r.latest...)
+		xor(d, raw)
+		var delta bytes.Buffer
+		w, err := flate.NewWriter(&delta, flate.BestSpeed)
+		if err != nil {
+			return err
+		}
+		w.Write(d)
+		if err := w.Close(); err != nil {
+			return err
+		}
+		last.delta = delta.Bytes()
+		r.size += len(last.delta)
+	}
+	r.size += len(raw) - len(r.latest)
+	r.latest = raw
+	r.snapshots = append(r.snapshots, &snapshot{})
+	r.isCut = false
+	return nil
+}
+
+//pop は最新のスナップショットを捨て，1つ古いものを latest に展開する
+func (r *Rewinder) pop() error {
+	prev := r.snapshots[len(r.snapshots)-2]
+	raw, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(prev.delta)))
+	if err != nil {
+		return err
+	}
+	xor(raw, r.latest)
+	r.size -= len(r.last().inputs)*inputSize + len(r.latest) + len(prev.delta)
+	r.size += len(raw)
+	r.snapshots = r.snapshots[:len(r.snapshots)-1]
+	r.latest = raw
+	prev.delta = nil
+	return nil
+}
+
+//evict は budget を超えた分を古いスナップショットから捨てる．最新のものは残す
+func (r *Rewinder) evict() {
+	for r.size > r.budget && len(r.snapshots) > 1 {
+		s := r.snapshots[0]
+		r.size -= len(s.delta) + len(s.inputs)*inputSize
+		r.snapshots[0] = nil
+		r.snapshots = r.snapshots[1:]
+	}
+}
+
+//restore は最新のスナップショットの状態に戻す
+func (r *Rewinder) restore() error {
+	s, err := r.decode(r.latest)
+	if err != nil {
+		return err
+	}
+	return r.console.setState(s)
+}
+
+//encode はスナップショットをバイト列にする．XOR の差分で位置がずれないよう，大きなメモリは
+//gob から外して頭に決まった順で並べる．画面は再生し直すと作られるので持たない
+func (r *Rewinder) encode(s State) ([]byte, error) {
+	var raw bytes.Buffer
+	raw.Write(s.CPU.RAM[:])
+	raw.Write(s.PPU.OAM[:])
+	raw.Write(s.PPU.NameTable[:])
+	raw.Write(s.PPU.Palette[:])
+	raw.Write(s.Cartridge.PRGRAM)
+	raw.Write(s.Cartridge.CHRRAM)
+	var zero State
+	s.CPU.RAM = zero.CPU.RAM
+	s.PPU.OAM = zero.PPU.OAM
+	s.PPU.NameTable = zero.PPU.NameTable
+	s.PPU.Palette = zero.PPU.Palette
+	s.Cartridge.PRGRAM, s.Cartridge.CHRRAM = nil, nil
+	s.PPU.Buffer, s.PPU.Screen = nil, nil
+	if err := gob.NewEncoder(&raw).Encode(s); err != nil {
+		return nil, err
+	}
+	return raw.Bytes(), nil
+}
+
+//decode は encode したバイト列を State に戻す
+func (r *Rewinder) decode(raw []byte) (State, error) {
+	cart := r.console.Cartridge
+	chrRAM := 0
+	if cart.IsCHRRAM {
+		chrRAM = len(cart.CHR)
+	}
+	var s State
+	memory := len(s.CPU.RAM) + len(s.PPU.OAM) + len(s.PPU.NameTable) + len(s.PPU.Palette) + len(cart.PRGRAM) + chrRAM
+	if len(raw) < memory {
+		return s, fmt.Errorf("console: rewind snapshot is too short")
+	}
+	if err := gob.NewDecoder(bytes.NewReader(raw[memory:])).Decode(&s); err != nil {
+		return s, err
+	}
+	n := copy(s.CPU.RAM[:], raw)
+	n += copy(s.PPU.OAM[:], raw[n:])
+	n += copy(s.PPU.NameTable[:], raw[n:])
+	n += copy(s.PPU.Palette[:], raw[n:])
+	s.Cartridge.PRGRAM = raw[n : n+len(cart.PRGRAM)]
+	n += len(cart.PRGRAM)
+	if cart.IsCHRRAM {
+		s.Cartridge.CHRRAM = raw[n : n+chrRAM]
+	}
+	return s, nil
+}
+
+//xor は a の各バイトに b の同じ位置のバイトを XOR する．b より長い分はそのまま
+func xor(a, b []byte) {
+	for i := range a {
+		if i >= len(b) {
+			return
+		}
+		a[i] ^= b[i]
+	}
+}
+
+//replay は最新のスナップショットから記録した入力で進め直し，各フレームの画面を取っておく
+func (r *Rewinder) replay() error {
+	if err := r.restore(); err != nil {
+		return err
+	}
+	r.screens = r.screens[:0]
+	for _, pads := range r.last().inputs {
+		r.console.StepFrame(pads)
+		r.screens = append(r.screens, r.console.PPU.Screen)
+	}
+	r.console.Samples()
+	r.shown = len(r.screens)
+	return nil
+}
+
+//resume は表示していたフレームの状態まで進め直し，その先の記録を捨てる
+func (r *Rewinder) resume() error {
+	if err := r.restore(); err != nil {
+		return err
+	}
+	for _, pads := range r.last().inputs[:r.shown] {
+		r.console.StepFrame(pads)
+	}
+	r.console.Samples()
+	r.truncate()
+	return nil
+}
+
+func (r *Rewinder) truncate() {
+	last := r.last()
+	r.size -= (len(last.inputs) - r.shown) * inputSize
+	last.inputs = last.inputs[:r.shown]
+	r.isRewinding = false
+}
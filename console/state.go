@@ -0,0 +1,163 @@
+package console
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pishiko/gones/apu"
+	"github.com/pishiko/gones/cartridge"
+	"github.com/pishiko/gones/cpu"
+	"github.com/pishiko/gones/input"
+	"github.com/pishiko/gones/ppu"
+)
+
+//セーブステートのファイルは stateMagic，版(uint32 BE)，State の gob の順に並ぶ
+const stateMagic = "GNST"
+
+//stateVersion は現在のセーブステートの版．
+//State やその中のフィールドの意味を変えたら上げて，前の版から直す関数を migrations に足す
+const stateVersion = 1
+
+//migrations[v] は版 v で書かれたステートを版 v+1 の形に直す．
+//gob はフィールド名で読むので，足したフィールドの既定値を埋めたり，名前を変えた値を移したりする
+var migrations = map[uint32]func(s *State) error{}
+
+//State はマシン全体の状態
+type State struct {
+	//Checksum はROMのCRC32．違うゲームのステートは読まない
+	Checksum  uint32
+	CPU       cpu.State
+	PPU       ppu.State
+	APU       apu.State
+	Cartridge cartridge.State
+	Input     input.State
+}
+
+//SaveState は現在の状態を w に書き出す．命令の区切りで呼ぶ
+func (c *Console) SaveState(w io.Writer) error {
+	s, err := c.state()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, stateMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(stateVersion)); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(s)
+}
+
+//LoadState は SaveState で書いた状態を読んで戻す．古い版は migrations で今の形に直す．
+//読めなかったときは元の状態のまま
+func (c *Console) LoadState(r io.Reader) error {
+	magic := make([]byte, len(stateMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return fmt.Errorf("console: reading state: %v", err)
+	}
+	if string(magic) != stateMagic {
+		return fmt.Errorf("console: not a save state")
+	}
+	var version uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return fmt.Errorf("console: reading state: %v", err)
+	}
+	if version == 0 || version > stateVersion {
+		return fmt.Errorf("console: unsupported save state version %d (current %d)", version, stateVersion)
+	}
+	var s State
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("console: decoding state: %v", err)
+	}
+	for v := version; v < stateVersion; v++ {
+		migrate, ok := migrations[v]
+		if !ok {
+			return fmt.Errorf("console: no migration from save state version %d", v)
+		}
+		if err := migrate(&s); err != nil {
+			return fmt.Errorf("console: migrating save state version %d: %v", v, err)
+		}
+	}
+	if s.Checksum != c.Cartridge.Checksum() {
+		return fmt.Errorf("console: save state is for another ROM")
+	}
+
+	backup, err := c.state()
+	if err != nil {
+		return err
+	}
+	if err := c.setState(s); err != nil {
+		c.setState(backup)
+		return err
+	}
+	return nil
+}
+
+//SaveStateFile はステートを path に書き出す
+func (c *Console) SaveStateFile(path string) error {
+	//途中で落ちても元のファイルが壊れないよう一時ファイルから置き換える
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = c.SaveState(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+//LoadStateFile は path のステートを読んで戻す
+func (c *Console) LoadStateFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := c.LoadState(bufio.NewReader(f)); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+func (c *Console) state() (State, error) {
+	cart, err := c.Cartridge.SaveState()
+	if err != nil {
+		return State{}, err
+	}
+	return State{
+		Checksum:  c.Cartridge.Checksum(),
+		CPU:       c.CPU.SaveState(),
+		PPU:       c.PPU.SaveState(),
+		APU:       c.APU.SaveState(),
+		Cartridge: cart,
+		Input:     c.Input.SaveState(),
+	}, nil
+}
+
+//setState は検証が要るカートリッジとPPUから戻す
+func (c *Console) setState(s State) error {
+	if err := c.Cartridge.LoadState(s.Cartridge); err != nil {
+		return err
+	}
+	if err := c.PPU.LoadState(s.PPU); err != nil {
+		return err
+	}
+	c.CPU.LoadState(s.CPU)
+	c.APU.LoadState(s.APU)
+	c.Input.LoadState(s.Input)
+	return nil
+}
@@ -0,0 +1,185 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pishiko/gones/cartridge"
+	"github.com/pishiko/gones/cpu"
+	"github.com/pishiko/gones/input"
+)
+
+//テストROMは配布できないので手元のディレクトリから読む．
+//$GONES_TESTROMS か console/testdata に，nestest.nes と Nintendulator のゴールデンログ nestest.log，
+//$6000 にステータスを書く blargg 形式のROMを blargg/ 以下に置く (無ければスキップ)
+func testROMDir() string {
+	if dir := os.Getenv("GONES_TESTROMS"); dir != "" {
+		return dir
+	}
+	return "testdata"
+}
+
+func loadTestROM(t *testing.T, path string) *Console {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Skipf("%s not found", path)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	cart, err := cartridge.Load(data)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return New(cart)
+}
+
+//TestNestest は nestest を自動モード($C000から)で動かし，ゴールデンログと1命令ずつ比べる
+func TestNestest(t *testing.T) {
+	dir := testROMDir()
+	c := loadTestROM(t, filepath.Join(dir, "nestest.nes"))
+	golden, err := readLines(filepath.Join(dir, "nestest.log"))
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var out bytes.Buffer
+	tracer := cpu.NewTracer(&out)
+	c.CPU.SetTracer(tracer)
+	c.CPU.PC = 0xc000
+	for range golden {
+		c.Step([2]input.Buttons{})
+	}
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Split(out.String(), "\n")
+	for i, want := range golden {
+		if i >= len(got) {
+			t.Fatalf("trace ended at line %d", i+1)
+		}
+		if !sameTrace(got[i], want) {
+			from := i - 3
+			if from < 0 {
+				from = 0
+			}
+			t.Fatalf("line %d differs\nwant: %s\ngot:  %s\nprevious:\n%s", i+1, want, got[i], strings.Join(got[from:i], "\n"))
+		}
+	}
+	//$02, $03 にはエラーコードが入る (0なら全て成功)
+	if r2, r3 := c.CPU.Peek(0x0002), c.CPU.Peek(0x0003); r2 != 0 || r3 != 0 {
+		t.Errorf("nestest reported $02=%02X $03=%02X", r2, r3)
+	}
+}
+
+//sameTrace はPC・命令のバイト列・レジスタ・CPUサイクルを比べる．
+//逆アセンブルに添える値はI/Oレジスタの読み方がエミュレータごとに違うので比べない
+func sameTrace(got, want string) bool {
+	if len(got) < 73 || len(want) < 73 {
+		return got == want
+	}
+	if got[:14] != want[:14] || got[48:73] != want[48:73] {
+		return false
+	}
+	if i := strings.Index(want, "CYC:"); i >= 0 {
+		j := strings.Index(got, "CYC:")
+		return j >= 0 && strings.TrimSpace(got[j:]) == strings.TrimSpace(want[i:])
+	}
+	return true
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := strings.TrimRight(s.Text(), "\r "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, s.Err()
+}
+
+const (
+	//blarggTimeoutFrames 結果が出るまで待つ最大フレーム数 (約1分)
+	blarggTimeoutFrames = 60 * 60
+	//blarggResetFrames $6000=$81 のときリセットまで待つフレーム数
+	blarggResetFrames = 6
+)
+
+//TestBlargg は blargg/ 以下の各ROMを動かし $6000 のステータスで合否を判定する
+func TestBlargg(t *testing.T) {
+	dir := filepath.Join(testROMDir(), "blargg")
+	var roms []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(strings.ToLower(path), ".nes") {
+			roms = append(roms, path)
+		}
+		return nil
+	})
+	if len(roms) == 0 {
+		t.Skipf("no test ROMs in %s", dir)
+	}
+	for _, rom := range roms {
+		rom := rom
+		name, _ := filepath.Rel(dir, rom)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			runBlargg(t, loadTestROM(t, rom))
+		})
+	}
+}
+
+//runBlargg は $6001-$6003 に DE B0 61 が書かれてから $6000 が $80 未満になるまで動かす．
+//$6000: $80 実行中，$81 リセット要求，それ以外は結果コード(0が成功)．$6004- に結果の文字列
+func runBlargg(t *testing.T, c *Console) {
+	resetAt := -1
+	for frame := 0; frame < blarggTimeoutFrames; frame++ {
+		c.StepFrame([2]input.Buttons{})
+		if err := c.CPU.Jammed(); err != nil {
+			t.Fatal(err)
+		}
+		if c.CPU.Peek(0x6001) != 0xde || c.CPU.Peek(0x6002) != 0xb0 || c.CPU.Peek(0x6003) != 0x61 {
+			continue
+		}
+		switch status := c.CPU.Peek(0x6000); status {
+		case 0x80:
+		case 0x81:
+			if resetAt < 0 {
+				resetAt = frame + blarggResetFrames
+			} else if frame >= resetAt {
+				c.Reset()
+				resetAt = -1
+			}
+		case 0x00:
+			t.Logf("passed: %s", blarggText(c))
+			return
+		default:
+			t.Fatalf("failed with code %d: %s", status, blarggText(c))
+		}
+	}
+	t.Fatalf("no result within %d frames: %s", blarggTimeoutFrames, blarggText(c))
+}
+
+func blarggText(c *Console) string {
+	var text []byte
+	for addr := uint16(0x6004); addr < 0x7000; addr++ {
+		b := c.CPU.Peek(addr)
+		if b == 0x00 {
+			break
+		}
+		text = append(text, b)
+	}
+	return strings.TrimSpace(string(text))
+}
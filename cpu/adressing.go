@@ -1,20 +1,25 @@
 package cpu
 
+//_read16 は下位・上位の順に読む
 func (c *CPU) _read16(addr uint16) uint16 {
-	return (uint16(c.read(addr+0x0001)) << 8) + uint16(c.read(addr))
+	low := uint16(c.read(addr))
+	return (uint16(c.read(addr+0x0001)) << 8) + low
 }
 
 func uint2int(n uint8) int {
 	return int(n&0x7f) - int(n>>7)*128
 }
 
+//accumulator, implied は2サイクル目に次のバイトをダミーで読む
 func (c *CPU) accumulator() uint16 {
 	c.isNoAddrOP = true
+	c.read(c.PC)
 	return 0x0000
 }
 
 func (c *CPU) implied() uint16 {
 	c.isNoAddrOP = true
+	c.read(c.PC)
 	return 0x0000
 }
 
@@ -28,14 +33,19 @@ func (c *CPU) zeropage() uint16 {
 	return uint16(c.read(c.PC - 0x0001))
 }
 
+//zeropageX, zeropageY はインデックスを足す前のアドレスをダミーで読む
 func (c *CPU) zeropageX() uint16 {
 	c.PC++
-	return uint16(c.read(c.PC-0x0001) + c.X)
+	base := c.read(c.PC - 0x0001)
+	c.read(uint16(base))
+	return uint16(base + c.X)
 }
 
 func (c *CPU) zeropageY() uint16 {
 	c.PC++
-	return uint16(c.read(c.PC-0x0001) + c.Y)
+	base := c.read(c.PC - 0x0001)
+	c.read(uint16(base))
+	return uint16(base + c.Y)
 }
 
 func (c *CPU) absolute() uint16 {
@@ -45,40 +55,57 @@ func (c *CPU) absolute() uint16 {
 
 func (c *CPU) absoluteX() uint16 {
 	c.PC += 0x0002
-	return c._read16(c.PC-0x0002) + uint16(c.X)
+	base := c._read16(c.PC - 0x0002)
+	return c.indexed(base, c.X)
 }
 
 func (c *CPU) absoluteY() uint16 {
 	c.PC += 0x0002
-	return c._read16(c.PC-0x0002) + uint16(c.Y)
+	base := c._read16(c.PC - 0x0002)
+	return c.indexed(base, c.Y)
 }
 
+//indirect はJMP専用．ポインタの上位バイトはページをまたがず同じページの先頭から読む
 func (c *CPU) indirect() uint16 {
 	c.PC += 0x0002
-	addrUp := c.read(c.PC - 0x0001)
-	addrLow := c.read(c.PC - 0x0002)
-
-	return (uint16(c.read((uint16(addrUp)<<8)+uint16(addrLow+0x01))) << 8) + uint16(c.read((uint16(addrUp)<<8)+uint16(addrLow)))
+	ptr := c._read16(c.PC - 0x0002)
+	low := uint16(c.read(ptr))
+	return uint16(c.read(ptr&0xff00|(ptr+0x0001)&0x00ff))<<8 | low
 }
 
+//Xindirect, indirectY のポインタはゼロページの中で折り返す
 func (c *CPU) Xindirect() uint16 {
 	c.PC++
-	addr := c.read(c.PC-0x0001) + c.X
-	return (uint16(c.read(uint16(addr+0x01))) << 8) + uint16(c.read(uint16(addr)))
+	ptr := c.read(c.PC - 0x0001)
+	c.read(uint16(ptr))
+	ptr += c.X
+	low := uint16(c.read(uint16(ptr)))
+	return uint16(c.read(uint16(ptr+0x01)))<<8 | low
 }
 
 func (c *CPU) indirectY() uint16 {
 	c.PC++
-	addr := c.read(c.PC - 0x0001)
-	return uint16(c.read(uint16(addr+0x01)))<<8 + uint16(c.read(uint16(addr))) + uint16(c.Y)
+	ptr := c.read(c.PC - 0x0001)
+	low := uint16(c.read(uint16(ptr)))
+	base := uint16(c.read(uint16(ptr+0x01)))<<8 | low
+	return c.indexed(base, c.Y)
+}
+
+//indexed は base+index を返す．ページをまたぐときと書き込み・RMW命令では
+//上位バイトを直す前のアドレスをダミーで読む
+func (c *CPU) indexed(base uint16, index uint8) uint16 {
+	addr := base + uint16(index)
+	if isPageCrossed(base, addr) || pageCrossCycles[c.opcode] == 0 {
+		c.read(base&0xff00 | addr&0x00ff)
+	}
+	return addr
+}
+
+func isPageCrossed(a, b uint16) bool {
+	return a&0xff00 != b&0xff00
 }
 
 func (c *CPU) relative() uint16 {
 	c.PC++
 	return uint16(int(c.PC) + uint2int(c.read(c.PC-0x0001)))
 }
-
-func (c *CPU) noAdressing() uint16 {
-	println("[NO ADRESSING] CANT REACH HERE")
-	return 0x0000
-}
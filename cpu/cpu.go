@@ -2,39 +2,39 @@ package cpu
 
 import (
 	"fmt"
-	"reflect"
-	"runtime"
-	"strings"
 
 	"github.com/pishiko/gones/apu"
+	"github.com/pishiko/gones/cartridge"
+	"github.com/pishiko/gones/input"
 	"github.com/pishiko/gones/ppu"
 )
 
 var (
-	cycles = [256]int{
-		/*0x00*/ 7, 6, 2, 8, 3, 3, 5, 5, 3, 2, 2, 2, 4, 4, 6, 6,
-		/*0x10*/ 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 6, 7,
-		/*0x20*/ 6, 6, 2, 8, 3, 3, 5, 5, 4, 2, 2, 2, 4, 4, 6, 6,
-		/*0x30*/ 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 6, 7,
-		/*0x40*/ 6, 6, 2, 8, 3, 3, 5, 5, 3, 2, 2, 2, 3, 4, 6, 6,
-		/*0x50*/ 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 6, 7,
-		/*0x60*/ 6, 6, 2, 8, 3, 3, 5, 5, 4, 2, 2, 2, 5, 4, 6, 6,
-		/*0x70*/ 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 6, 7,
-		/*0x80*/ 2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4,
-		/*0x90*/ 2, 6, 2, 6, 4, 4, 4, 4, 2, 4, 2, 5, 5, 4, 5, 5,
-		/*0xA0*/ 2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4,
-		/*0xB0*/ 2, 5, 2, 5, 4, 4, 4, 4, 2, 4, 2, 4, 4, 4, 4, 4,
-		/*0xC0*/ 2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6,
-		/*0xD0*/ 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
-		/*0xE0*/ 2, 6, 3, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6,
-		/*0xF0*/ 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+	//pageCrossCycles ページをまたいだときだけ1サイクル増える読み込み命令．
+	//0の命令(書き込み・RMW)はインデックス付きアドレッシングで常にダミー読み込みをする
+	pageCrossCycles = [256]int{
+		/*0x00*/ 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		/*0x10*/ 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 1, 0, 0,
+		/*0x20*/ 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		/*0x30*/ 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 1, 0, 0,
+		/*0x40*/ 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		/*0x50*/ 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 1, 0, 0,
+		/*0x60*/ 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		/*0x70*/ 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 1, 0, 0,
+		/*0x80*/ 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		/*0x90*/ 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		/*0xA0*/ 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		/*0xB0*/ 0, 1, 0, 1, 0, 0, 0, 0, 0, 1, 0, 1, 1, 1, 1, 1,
+		/*0xC0*/ 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		/*0xD0*/ 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 1, 0, 0,
+		/*0xE0*/ 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		/*0xF0*/ 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 1, 0, 0,
 	}
-	debugCounter = 7
 )
 
 //CPU CPU
 type CPU struct {
-	prgROM                 []uint8
+	mapper                 cartridge.Mapper
 	A, X, Y, SP            uint8
 	PC                     uint16
 	N, V, R, B, D, I, Z, C bool
@@ -43,46 +43,54 @@ type CPU struct {
 	adrTable               [256]func() uint16
 	ppu                    *ppu.PPU
 	apu                    *apu.APU
+	input                  *input.Ports
 	//
-	keys           [8]bool
-	isKeyReset     bool
-	keyCounter     int
-	addtionalCycle int
-	isNoAddrOP     bool
+	isNoAddrOP bool
+	//opcode は実行中の命令
+	opcode uint8
+	//cycle は電源投入からのCPUサイクル数
+	cycle int
+	//割り込み
+	prevNMILine bool
+	needNMI     bool
+	prevNeedNMI bool
+	runIRQ      bool
+	prevRunIRQ  bool
+	//jam はJAM命令で止まっているときの状態
+	jam *JamError
 	//DEBUG
-	IsRecord bool
-	DebugLog string
+	tracer *Tracer
 }
 
 //NewCPU Constructer
-func NewCPU(prg []uint8, ppu *ppu.PPU, apu *apu.APU) *CPU {
+func NewCPU(mapper cartridge.Mapper, ppu *ppu.PPU, apu *apu.APU, ports *input.Ports) *CPU {
 	cpu := new(CPU)
-	cpu.prgROM = prg
-	cpu.SP = 0xFD
+	cpu.mapper = mapper
 	cpu.wRAM = [0x0800]uint8{}
 	cpu.R = true
 	cpu.B = false
 	cpu.I = true
 	cpu.ppu = ppu
 	cpu.apu = apu
+	cpu.input = ports
 
 	cpu.opTable = [256]func(uint16){
-		cpu.BRK, cpu.ORA, cpu.NOP, cpu.NOP, cpu.NOP, cpu.ORA, cpu.ASL, cpu.NOP, cpu.PHP, cpu.ORA, cpu.ASL, cpu.NOP, cpu.NOP, cpu.ORA, cpu.ASL, cpu.NOP,
-		cpu.BPL, cpu.ORA, cpu.NOP, cpu.NOP, cpu.NOP, cpu.ORA, cpu.ASL, cpu.NOP, cpu.CLC, cpu.ORA, cpu.NOP, cpu.NOP, cpu.NOP, cpu.ORA, cpu.ASL, cpu.NOP,
-		cpu.JSR, cpu.AND, cpu.NOP, cpu.NOP, cpu.BIT, cpu.AND, cpu.ROL, cpu.NOP, cpu.PLP, cpu.AND, cpu.ROL, cpu.NOP, cpu.BIT, cpu.AND, cpu.ROL, cpu.NOP,
-		cpu.BMI, cpu.AND, cpu.NOP, cpu.NOP, cpu.NOP, cpu.AND, cpu.ROL, cpu.NOP, cpu.SEC, cpu.AND, cpu.NOP, cpu.NOP, cpu.NOP, cpu.AND, cpu.ROL, cpu.NOP,
-		cpu.RTI, cpu.EOR, cpu.NOP, cpu.NOP, cpu.NOP, cpu.EOR, cpu.LSR, cpu.NOP, cpu.PHA, cpu.EOR, cpu.LSR, cpu.NOP, cpu.JMP, cpu.EOR, cpu.LSR, cpu.NOP,
-		cpu.BVC, cpu.EOR, cpu.NOP, cpu.NOP, cpu.NOP, cpu.EOR, cpu.LSR, cpu.NOP, cpu.CLI, cpu.EOR, cpu.NOP, cpu.NOP, cpu.NOP, cpu.EOR, cpu.LSR, cpu.NOP,
-		cpu.RTS, cpu.ADC, cpu.NOP, cpu.NOP, cpu.NOP, cpu.ADC, cpu.ROR, cpu.NOP, cpu.PLA, cpu.ADC, cpu.ROR, cpu.NOP, cpu.JMP, cpu.ADC, cpu.ROR, cpu.NOP,
-		cpu.BVS, cpu.ADC, cpu.NOP, cpu.NOP, cpu.NOP, cpu.ADC, cpu.ROR, cpu.NOP, cpu.SEI, cpu.ADC, cpu.NOP, cpu.NOP, cpu.NOP, cpu.ADC, cpu.ROR, cpu.NOP,
-		cpu.NOP, cpu.STA, cpu.NOP, cpu.NOP, cpu.STY, cpu.STA, cpu.STX, cpu.NOP, cpu.DEY, cpu.NOP, cpu.TXA, cpu.NOP, cpu.STY, cpu.STA, cpu.STX, cpu.NOP,
-		cpu.BCC, cpu.STA, cpu.NOP, cpu.NOP, cpu.STY, cpu.STA, cpu.STX, cpu.NOP, cpu.TYA, cpu.STA, cpu.TXS, cpu.NOP, cpu.NOP, cpu.STA, cpu.NOP, cpu.NOP,
-		cpu.LDY, cpu.LDA, cpu.LDX, cpu.NOP, cpu.LDY, cpu.LDA, cpu.LDX, cpu.NOP, cpu.TAY, cpu.LDA, cpu.TAX, cpu.NOP, cpu.LDY, cpu.LDA, cpu.LDX, cpu.NOP,
-		cpu.BCS, cpu.LDA, cpu.NOP, cpu.NOP, cpu.LDY, cpu.LDA, cpu.LDX, cpu.NOP, cpu.CLV, cpu.LDA, cpu.TSX, cpu.NOP, cpu.LDY, cpu.LDA, cpu.LDX, cpu.NOP,
-		cpu.CPY, cpu.CMP, cpu.NOP, cpu.NOP, cpu.CPY, cpu.CMP, cpu.DEC, cpu.NOP, cpu.INY, cpu.CMP, cpu.DEX, cpu.NOP, cpu.CPY, cpu.CMP, cpu.DEC, cpu.NOP,
-		cpu.BNE, cpu.CMP, cpu.NOP, cpu.NOP, cpu.NOP, cpu.CMP, cpu.DEC, cpu.NOP, cpu.CLD, cpu.CMP, cpu.NOP, cpu.NOP, cpu.NOP, cpu.CMP, cpu.DEC, cpu.NOP,
-		cpu.CPX, cpu.SBC, cpu.NOP, cpu.NOP, cpu.CPX, cpu.SBC, cpu.INC, cpu.NOP, cpu.INX, cpu.SBC, cpu.NOP, cpu.NOP, cpu.CPX, cpu.SBC, cpu.INC, cpu.NOP,
-		cpu.BEQ, cpu.SBC, cpu.NOP, cpu.NOP, cpu.NOP, cpu.SBC, cpu.INC, cpu.NOP, cpu.SED, cpu.SBC, cpu.NOP, cpu.NOP, cpu.NOP, cpu.SBC, cpu.INC, cpu.NOP,
+		cpu.BRK, cpu.ORA, cpu.JAM, cpu.SLO, cpu.IGN, cpu.ORA, cpu.ASL, cpu.SLO, cpu.PHP, cpu.ORA, cpu.ASL, cpu.ANC, cpu.IGN, cpu.ORA, cpu.ASL, cpu.SLO,
+		cpu.BPL, cpu.ORA, cpu.JAM, cpu.SLO, cpu.IGN, cpu.ORA, cpu.ASL, cpu.SLO, cpu.CLC, cpu.ORA, cpu.NOP, cpu.SLO, cpu.IGN, cpu.ORA, cpu.ASL, cpu.SLO,
+		cpu.JSR, cpu.AND, cpu.JAM, cpu.RLA, cpu.BIT, cpu.AND, cpu.ROL, cpu.RLA, cpu.PLP, cpu.AND, cpu.ROL, cpu.ANC, cpu.BIT, cpu.AND, cpu.ROL, cpu.RLA,
+		cpu.BMI, cpu.AND, cpu.JAM, cpu.RLA, cpu.IGN, cpu.AND, cpu.ROL, cpu.RLA, cpu.SEC, cpu.AND, cpu.NOP, cpu.RLA, cpu.IGN, cpu.AND, cpu.ROL, cpu.RLA,
+		cpu.RTI, cpu.EOR, cpu.JAM, cpu.SRE, cpu.IGN, cpu.EOR, cpu.LSR, cpu.SRE, cpu.PHA, cpu.EOR, cpu.LSR, cpu.ALR, cpu.JMP, cpu.EOR, cpu.LSR, cpu.SRE,
+		cpu.BVC, cpu.EOR, cpu.JAM, cpu.SRE, cpu.IGN, cpu.EOR, cpu.LSR, cpu.SRE, cpu.CLI, cpu.EOR, cpu.NOP, cpu.SRE, cpu.IGN, cpu.EOR, cpu.LSR, cpu.SRE,
+		cpu.RTS, cpu.ADC, cpu.JAM, cpu.RRA, cpu.IGN, cpu.ADC, cpu.ROR, cpu.RRA, cpu.PLA, cpu.ADC, cpu.ROR, cpu.ARR, cpu.JMP, cpu.ADC, cpu.ROR, cpu.RRA,
+		cpu.BVS, cpu.ADC, cpu.JAM, cpu.RRA, cpu.IGN, cpu.ADC, cpu.ROR, cpu.RRA, cpu.SEI, cpu.ADC, cpu.NOP, cpu.RRA, cpu.IGN, cpu.ADC, cpu.ROR, cpu.RRA,
+		cpu.IGN, cpu.STA, cpu.IGN, cpu.SAX, cpu.STY, cpu.STA, cpu.STX, cpu.SAX, cpu.DEY, cpu.IGN, cpu.TXA, cpu.XAA, cpu.STY, cpu.STA, cpu.STX, cpu.SAX,
+		cpu.BCC, cpu.STA, cpu.JAM, cpu.AHX, cpu.STY, cpu.STA, cpu.STX, cpu.SAX, cpu.TYA, cpu.STA, cpu.TXS, cpu.TAS, cpu.SHY, cpu.STA, cpu.SHX, cpu.AHX,
+		cpu.LDY, cpu.LDA, cpu.LDX, cpu.LAX, cpu.LDY, cpu.LDA, cpu.LDX, cpu.LAX, cpu.TAY, cpu.LDA, cpu.TAX, cpu.LXA, cpu.LDY, cpu.LDA, cpu.LDX, cpu.LAX,
+		cpu.BCS, cpu.LDA, cpu.JAM, cpu.LAX, cpu.LDY, cpu.LDA, cpu.LDX, cpu.LAX, cpu.CLV, cpu.LDA, cpu.TSX, cpu.LAS, cpu.LDY, cpu.LDA, cpu.LDX, cpu.LAX,
+		cpu.CPY, cpu.CMP, cpu.IGN, cpu.DCP, cpu.CPY, cpu.CMP, cpu.DEC, cpu.DCP, cpu.INY, cpu.CMP, cpu.DEX, cpu.AXS, cpu.CPY, cpu.CMP, cpu.DEC, cpu.DCP,
+		cpu.BNE, cpu.CMP, cpu.JAM, cpu.DCP, cpu.IGN, cpu.CMP, cpu.DEC, cpu.DCP, cpu.CLD, cpu.CMP, cpu.NOP, cpu.DCP, cpu.IGN, cpu.CMP, cpu.DEC, cpu.DCP,
+		cpu.CPX, cpu.SBC, cpu.IGN, cpu.ISC, cpu.CPX, cpu.SBC, cpu.INC, cpu.ISC, cpu.INX, cpu.SBC, cpu.NOP, cpu.SBC, cpu.CPX, cpu.SBC, cpu.INC, cpu.ISC,
+		cpu.BEQ, cpu.SBC, cpu.JAM, cpu.ISC, cpu.IGN, cpu.SBC, cpu.INC, cpu.ISC, cpu.SED, cpu.SBC, cpu.NOP, cpu.ISC, cpu.IGN, cpu.SBC, cpu.INC, cpu.ISC,
 	}
 	cpu.adrTable = [256]func() uint16{
 		/*0x00*/ cpu.implied, cpu.Xindirect, cpu.implied, cpu.Xindirect, cpu.zeropage, cpu.zeropage, cpu.zeropage, cpu.zeropage, cpu.implied, cpu.immediate, cpu.accumulator, cpu.immediate, cpu.absolute, cpu.absolute, cpu.absolute, cpu.absolute,
@@ -103,7 +111,6 @@ func NewCPU(prg []uint8, ppu *ppu.PPU, apu *apu.APU) *CPU {
 		/*0xF0*/ cpu.relative, cpu.indirectY, cpu.implied, cpu.indirectY, cpu.zeropageX, cpu.zeropageX, cpu.zeropageX, cpu.zeropageX, cpu.implied, cpu.absoluteY, cpu.implied, cpu.absoluteY, cpu.absoluteX, cpu.absoluteX, cpu.absoluteX, cpu.absoluteX,
 	}
 
-	//fmt.Printf("[Init CPU] Program Size:0x%x\n", len(cpu.prgROM))
 	cpu.RESET()
 	return cpu
 }
@@ -116,105 +123,76 @@ func (c *CPU) GetDebugText() string {
 	return fmt.Sprintf("$57:%X $86:%X $45:%X\n", c.wRAM[0x57], c.wRAM[0x86], c.wRAM[0x45])
 }
 
-func (c *CPU) excute(opcode uint8) int {
-	if c.IsRecord {
-		// if debugCounter >= 1000000 {
-		// 	os.Exit(0)
-		// }
-
-		c.DebugLog += fmt.Sprintf("%04X %02X %16s A:%02X X:%02X Y:%02X P:%02X SP:%02X\n", c.PC-1, opcode,
-			strings.Replace(strings.Replace(runtime.FuncForPC(reflect.ValueOf(c.opTable[opcode]).Pointer()).Name()+runtime.FuncForPC(reflect.ValueOf(c.adrTable[opcode]).Pointer()).Name(),
-				"github.com/pishiko/gones/cpu.(*CPU).", "", 2), "fm", "", 2),
-			c.A, c.X, c.Y, c.getP(), c.SP)
-		// c.DebugLog += fmt.Sprintf("%04X A:%02X X:%02X Y:%02X P:%02X SP:%02X\n", c.PC-1,
-		// 	c.A, c.X, c.Y, c.getP(), c.SP)
-
-		// fmt.Printf("%0X\n", c.PC-1)
-	}
-
+func (c *CPU) excute(opcode uint8) {
 	c.isNoAddrOP = false
+	c.opcode = opcode
 	c.opTable[opcode](c.adrTable[opcode]())
-
-	a := c.addtionalCycle
-	c.addtionalCycle = 0
-	cycle := cycles[opcode] + a
-	debugCounter += cycle
-	return cycle
+	return
 }
 
+//read は1サイクル進めてからバスを読む
 func (c *CPU) read(addr uint16) uint8 {
+	c.tick()
 	switch {
 	case addr < 0x0800:
 		return c.wRAM[addr]
 	case addr < 0x2000:
 		return c.wRAM[addr%0x0800]
-	case addr < 0x2008:
-		return c.ppu.ReadRegister(addr)
+	//$2008-$3FFF は8バイトごとのミラー
 	case addr < 0x4000:
-		fmt.Println("PPUMIRROR")
+		return c.ppu.ReadRegister(0x2000 | addr&0x0007)
 	case addr < 0x4020:
 		switch addr {
-		//Joypad 1
+		//Joypad 1,2．上位bitにはアドレスの上位バイトが残る
 		case 0x4016:
-			if c.keys[c.keyCounter] {
-				c.keyCounter = (c.keyCounter + 1) % 8
-				return 0x01
-			} else {
-				c.keyCounter = (c.keyCounter + 1) % 8
-				return 0x00
-			}
-		//Joypad 2
+			return c.input.Read(0, uint8(addr>>8))
 		case 0x4017:
-			//
+			return c.input.Read(1, uint8(addr>>8))
 		default:
 			return c.apu.Read(addr)
 		}
-	case addr < 0xbfff:
-		return c.prgROM[addr-0x8000]
-	case addr < 0xffff:
-		//Mapper 0 Mirror
-		return c.prgROM[addr-0x8000-(0x8000-uint16(len(c.prgROM)))]
+	default:
+		return c.mapper.ReadCPU(addr)
 	}
-	//CANT REACH HERE!
-	return 0
 }
 
+//Peek は副作用なしにバスを読む．PPU/APU/コントローラのレジスタは0を返す
+func (c *CPU) Peek(addr uint16) uint8 {
+	switch {
+	case addr < 0x2000:
+		return c.wRAM[addr%0x0800]
+	case addr < 0x4020:
+		return 0x00
+	default:
+		return c.mapper.ReadCPU(addr)
+	}
+}
+
+//write は1サイクル進めてからバスに書く
 func (c *CPU) write(addr uint16, data uint8) {
+	c.tick()
 	switch {
 	case addr < 0x0800:
 		c.wRAM[addr] = data
 	case addr < 0x2000:
 		c.wRAM[addr%0x0800] = data
-	case addr < 0x2008:
-		c.ppu.WriteRegister(addr, data)
 	case addr < 0x4000:
-		fmt.Println("PPU MIRROR WRITE")
+		c.ppu.WriteRegister(0x2000|addr&0x0007, data)
 	case addr < 0x4020:
 		switch addr {
 		//DMA
 		case 0x4014:
 			c.DMA(data)
-		//Joypad 1
+		//Joypad ストローブ
 		case 0x4016:
-			if data == 0x01 {
-				c.isKeyReset = true
-			} else if c.isKeyReset && data == 0x00 {
-				for i := range c.keys {
-					c.keys[i] = false
-				}
-				c.keyCounter = 0
-				c.isKeyReset = false
-			}
-		//Joypad 2
-		case 0x4017:
-			//
+			c.input.Write(data)
 		default:
+			//$4017 への書き込みはAPUのフレームカウンタ
 			c.apu.Write(addr, data)
 		}
-	case addr < 0xFFFF:
-		fmt.Printf("#WPRG %x %x\n", addr, data)
+	default:
+		c.mapper.WriteCPU(addr, data)
 	}
-	//CANT REACH HERE!
 }
 
 func (c *CPU) push(data uint8) {
@@ -230,34 +208,87 @@ func (c *CPU) pop() uint8 {
 	return c.read(addr)
 }
 
-// Run 実行
-func (c *CPU) Run(keys [8]bool) int {
-	for k := range keys {
-		if keys[k] {
-			c.keys[k] = true
-		}
+// Run 1命令(または割り込み)を実行し，かかったCPUサイクル数を返す
+func (c *CPU) Run() int {
+	start := c.cycle
+	if c.jam != nil {
+		c.tick()
+		return c.cycle - start
 	}
-	if c.ppu.IsNMIOccured {
-		c.ppu.IsNMIOccured = false
-		c.NMI()
+	//DMCのサンプル読み出し中はCPUが止まる
+	for stall := c.apu.Stall(); stall > 0; stall-- {
+		c.tick()
+	}
+	if c.tracer != nil {
+		c.tracer.trace(c)
 	}
 	opcode := c.read(c.PC)
 	c.PC++
-	return c.excute(opcode)
+	c.excute(opcode)
+	//最後から2番目のサイクルで検出した割り込みを受け付ける
+	if c.prevNeedNMI || c.prevRunIRQ {
+		c.interrupt()
+	}
+	return c.cycle - start
+}
+
+//tick はCPU 1サイクル分，PPU(3ドット)・APU・マッパーを進める
+func (c *CPU) tick() {
+	c.ppu.Run(3)
+	c.apu.Run(1)
+	c.mapper.Step()
+	c.cycle++
+	c.pollInterrupts()
+	return
+}
+
+//pollInterrupts はサイクルの終わりに割り込み線を見る．
+//NMIは立ち上がりエッジ，IRQはレベルで検出し，1サイクル前の値を命令の終わりで使う
+func (c *CPU) pollInterrupts() {
+	c.prevNeedNMI = c.needNMI
+	nmi := c.ppu.NMILine()
+	if nmi && !c.prevNMILine {
+		c.needNMI = true
+	}
+	c.prevNMILine = nmi
+	c.prevRunIRQ = c.runIRQ
+	c.runIRQ = c.isIRQLine() && !c.I
+	return
+}
+
+//isIRQLine はAPUとマッパーで共有するIRQ線．どれかが出していればLow(true)
+func (c *CPU) isIRQLine() bool {
+	return c.apu.IRQ() || c.mapper.IRQ()
 }
 
+//DMA は $4014 の書き込みでOAMへ256バイト転送する．
+//待ちの1サイクル(奇数サイクルならさらに1サイクル)と読み書き256回で513/514サイクル
 func (c *CPU) DMA(addrUp uint8) {
 	addr := uint16(addrUp) << 8
+	c.tick()
+	if c.cycle%2 == 1 {
+		c.tick()
+	}
 	var i uint16
 	for i = 0; i < 0x0100; i++ {
-		c.ppu.OAM[i] = c.read(addr + i)
+		data := c.read(addr + i)
+		c.tick()
+		c.ppu.WriteRegister(0x2004, data)
 	}
-	c.addtionalCycle += 514
 }
+
+//RESET は割り込みと同じ7サイクルの手順で，スタックには書かずSPだけ3つ下げる
 func (c *CPU) RESET() {
+	c.jam = nil
+	c.read(c.PC)
+	c.read(c.PC)
+	for i := 0; i < 3; i++ {
+		c.read(0x0100 + uint16(c.SP))
+		c.SP--
+	}
 	c.I = true
 	//c.PC = 0xc000
-	c.PC = (uint16(c.read(0xfffd+(uint16(len(c.prgROM))-0x8000))) << 8) + uint16(c.read(0xfffc+(uint16(len(c.prgROM))-0x8000)))
+	c.PC = c._read16(0xfffc)
 
 	return
 }
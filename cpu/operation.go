@@ -49,29 +49,25 @@ func (c *CPU) setP(p uint8) {
 
 //演算
 func (c *CPU) ADC(m uint16) {
-	data := c.read(m)
-	aFuture := c.A + data
-	if c.C {
-		aFuture += 0x01
-	}
-
-	c.C = c.A > aFuture
-	c.V = !((c.A^data)&0x80 != 0x00) && (c.A^aFuture)&0x80 != 0x00
-	c.A = aFuture
-	c.setNZ(c.A)
+	c.adc(c.read(m))
 	return
 }
 
 func (c *CPU) SBC(m uint16) {
-	data := c.read(m)
-	aFuture := c.A - data
-	if !c.C {
-		aFuture -= 0x01
-	}
+	//A - M - (1-C) は A + ^M + C と同じ
+	c.adc(^c.read(m))
+	return
+}
 
-	c.C = c.A >= aFuture
-	c.V = ((c.A^data)&0x80) != 0x00 && ((c.A^aFuture)&0x80) != 0x00
-	c.A = aFuture
+func (c *CPU) adc(data uint8) {
+	sum := uint16(c.A) + uint16(data)
+	if c.C {
+		sum++
+	}
+	result := uint8(sum)
+	c.C = sum > 0x00ff
+	c.V = (c.A^result)&(data^result)&0x80 != 0x00
+	c.A = result
 	c.setNZ(c.A)
 	return
 }
@@ -95,6 +91,13 @@ func (c *CPU) EOR(m uint16) {
 	return
 }
 
+//readModify はRMW命令の読み込みと，元の値の書き戻し(ダミー書き込み)をする
+func (c *CPU) readModify(m uint16) uint8 {
+	data := c.read(m)
+	c.write(m, data)
+	return data
+}
+
 //シフト・ローテーション
 func (c *CPU) ASL(m uint16) {
 	if c.isNoAddrOP {
@@ -102,7 +105,7 @@ func (c *CPU) ASL(m uint16) {
 		c.A = c.A << 1
 		c.setNZ(c.A)
 	} else {
-		data := c.read(m)
+		data := c.readModify(m)
 		c.C = data&0x80 != 0x00
 		data = data << 1
 		c.setNZ(data)
@@ -117,7 +120,7 @@ func (c *CPU) LSR(m uint16) {
 		c.A = c.A >> 1
 		c.setNZ(c.A)
 	} else {
-		data := c.read(m)
+		data := c.readModify(m)
 		c.C = data&0x01 != 0x00
 		data = data >> 1
 		c.setNZ(data)
@@ -136,7 +139,7 @@ func (c *CPU) ROL(m uint16) {
 		c.C = futureC
 		c.setNZ(c.A)
 	} else {
-		data := c.read(m)
+		data := c.readModify(m)
 		futureC := data&0x80 != 0x00
 		data = data << 1
 		if c.C {
@@ -159,7 +162,7 @@ func (c *CPU) ROR(m uint16) {
 		c.C = futureC
 		c.setNZ(c.A)
 	} else {
-		data := c.read(m)
+		data := c.readModify(m)
 		futureC := data&0x01 != 0x00
 		data = data >> 1
 		if c.C {
@@ -173,58 +176,72 @@ func (c *CPU) ROR(m uint16) {
 }
 
 //条件分岐
+//branch は分岐成立で1サイクル，ページをまたぐとさらに1サイクル(ダミー読み込み)増える
+func (c *CPU) branch(addr uint16) {
+	//ページをまたがない分岐は最後のサイクルで割り込みを見ないので，次の命令の後になる
+	if c.runIRQ && !c.prevRunIRQ && !isPageCrossed(c.PC, addr) {
+		c.runIRQ = false
+	}
+	c.read(c.PC)
+	if isPageCrossed(c.PC, addr) {
+		c.read(c.PC&0xff00 | addr&0x00ff)
+	}
+	c.PC = addr
+	return
+}
+
 func (c *CPU) BCC(addr uint16) {
 	if !c.C {
-		c.PC = addr
+		c.branch(addr)
 	}
 	return
 }
 
 func (c *CPU) BCS(addr uint16) {
 	if c.C {
-		c.PC = addr
+		c.branch(addr)
 	}
 	return
 }
 
 func (c *CPU) BEQ(addr uint16) {
 	if c.Z {
-		c.PC = addr
+		c.branch(addr)
 	}
 	return
 }
 
 func (c *CPU) BNE(addr uint16) {
 	if !c.Z {
-		c.PC = addr
+		c.branch(addr)
 	}
 	return
 }
 
 func (c *CPU) BVC(addr uint16) {
 	if !c.V {
-		c.PC = addr
+		c.branch(addr)
 	}
 	return
 }
 
 func (c *CPU) BVS(addr uint16) {
 	if c.V {
-		c.PC = addr
+		c.branch(addr)
 	}
 	return
 }
 
 func (c *CPU) BPL(addr uint16) {
 	if !c.N {
-		c.PC = addr
+		c.branch(addr)
 	}
 	return
 }
 
 func (c *CPU) BMI(addr uint16) {
 	if c.N {
-		c.PC = addr
+		c.branch(addr)
 	}
 	return
 }
@@ -244,6 +261,7 @@ func (c *CPU) JMP(addr uint16) {
 	return
 }
 func (c *CPU) JSR(addr uint16) {
+	c.read(0x0100 + uint16(c.SP))
 	word := c.PC - 0x0001
 	c.push(uint8(word >> 8))
 	c.push(uint8(word & 0x00ff))
@@ -251,29 +269,30 @@ func (c *CPU) JSR(addr uint16) {
 	return
 }
 func (c *CPU) RTS(_ uint16) {
+	c.read(0x0100 + uint16(c.SP))
 	wordL := c.pop()
 	wordU := c.pop()
-	c.PC = (uint16(wordU) << 8) + uint16(wordL) + 0x0001
+	c.PC = (uint16(wordU) << 8) + uint16(wordL)
+	c.read(c.PC)
+	c.PC++
 	return
 }
 
 //ソフトウェア割込み
+//BRK はIフラグに関係なく実行する．PCを積んだ後にNMIが来ていればNMIのベクタに化ける
 func (c *CPU) BRK(_ uint16) {
-	if !c.I {
-		c.B = true
-		c.PC++
-		c.push(uint8(c.PC >> 8))
-		c.push(uint8(c.PC & 0x00ff))
-		p := c.getP()
-		p = p&0xcf + 0x30
-		c.push(p)
-		c.I = true
-		c.PC = (uint16(c.read(0xffff)) << 8) + uint16(c.read(0xfffe))
-	}
+	c.PC++
+	c.push(uint8(c.PC >> 8))
+	c.push(uint8(c.PC & 0x00ff))
+	vector := c.interruptVector(0xfffe)
+	c.push(c.getP()&0xcf + 0x30)
+	c.I = true
+	c.PC = c._read16(vector)
 	return
 }
 
 func (c *CPU) RTI(_ uint16) {
+	c.read(0x0100 + uint16(c.SP))
 	c.setP((c.pop() & 0xcf) + (c.getP() & 0x30))
 	wordL := c.pop()
 	wordU := c.pop()
@@ -283,34 +302,34 @@ func (c *CPU) RTI(_ uint16) {
 
 //比較
 func (c *CPU) CMP(m uint16) {
-	a := c.A - c.read(m)
-	c.C = a <= c.A
-	c.setNZ(a)
+	c.compare(c.A, c.read(m))
 	return
 }
 
 func (c *CPU) CPX(m uint16) {
-	a := c.X - c.read(m)
-	c.C = a <= c.X
-	c.setNZ(a)
+	c.compare(c.X, c.read(m))
 	return
 }
 
 func (c *CPU) CPY(m uint16) {
-	a := c.Y - c.read(m)
-	c.C = a <= c.Y
-	c.setNZ(a)
+	c.compare(c.Y, c.read(m))
+	return
+}
+
+func (c *CPU) compare(reg uint8, data uint8) {
+	c.C = reg >= data
+	c.setNZ(reg - data)
 	return
 }
 
 func (c *CPU) INC(m uint16) {
-	a := c.read(m) + 0x0001
+	a := c.readModify(m) + 0x0001
 	c.write(m, a)
 	c.setNZ(a)
 	return
 }
 func (c *CPU) DEC(m uint16) {
-	a := c.read(m) - 0x0001
+	a := c.readModify(m) - 0x0001
 	c.write(m, a)
 	c.setNZ(a)
 	return
@@ -434,6 +453,7 @@ func (c *CPU) PHA(_ uint16) {
 	return
 }
 func (c *CPU) PLA(_ uint16) {
+	c.read(0x0100 + uint16(c.SP))
 	c.A = c.pop()
 	c.setNZ(c.A)
 	return
@@ -445,6 +465,7 @@ func (c *CPU) PHP(_ uint16) {
 	return
 }
 func (c *CPU) PLP(_ uint16) {
+	c.read(0x0100 + uint16(c.SP))
 	c.setP((c.pop() & 0xcf) + (c.getP() & 0x30))
 	return
 }
@@ -456,22 +477,24 @@ func (c *CPU) NOP(_ uint16) {
 }
 
 //ハードウェア割り込み
-func (c *CPU) NMI() {
-	c.B = false
+//interrupt はNMIかIRQを受け付ける．IRQでもPCを積むまでにNMIが来ればNMIのベクタを読む
+func (c *CPU) interrupt() {
+	c.read(c.PC)
+	c.read(c.PC)
 	c.push(uint8(c.PC >> 8))
 	c.push(uint8(c.PC & 0x00ff))
+	vector := c.interruptVector(0xfffe)
 	c.push(c.getP()&0xcf + 0x20)
 	c.I = true
-	c.PC = (uint16(c.read(0xfffb+(uint16(len(c.prgROM))-0x8000))) << 8) + uint16(c.read(0xfffa+(uint16(len(c.prgROM))-0x8000)))
-}
-func (c *CPU) IRQ() {
-	if !c.I {
-		c.B = false
-		c.push(uint8(c.PC >> 8))
-		c.push(uint8(c.PC & 0x00ff))
-		c.push(c.getP()&0xcf + 0x20)
-		c.I = true
-		c.PC = (uint16(c.read(0xffff)) << 8) + uint16(c.read(0xfffe))
-	}
+	c.PC = c._read16(vector)
 	return
 }
+
+//interruptVector はNMIが保留されていればそれを消費して $FFFA を，なければ vector を返す
+func (c *CPU) interruptVector(vector uint16) uint16 {
+	if c.needNMI {
+		c.needNMI = false
+		return 0xfffa
+	}
+	return vector
+}
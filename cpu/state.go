@@ -0,0 +1,56 @@
+package cpu
+
+//State はセーブステートに書き出すCPUの状態．命令の区切りでだけ取る
+type State struct {
+	A, X, Y, SP            uint8
+	PC                     uint16
+	N, V, R, B, D, I, Z, C bool
+	RAM                    [0x0800]uint8
+	Cycle                  int
+	//割り込み
+	PrevNMILine bool
+	NeedNMI     bool
+	PrevNeedNMI bool
+	RunIRQ      bool
+	PrevRunIRQ  bool
+	Jam         *JamError
+}
+
+//SaveState は現在の状態を返す
+func (c *CPU) SaveState() State {
+	s := State{
+		A: c.A, X: c.X, Y: c.Y, SP: c.SP, PC: c.PC,
+		N: c.N, V: c.V, R: c.R, B: c.B, D: c.D, I: c.I, Z: c.Z, C: c.C,
+		RAM:         c.wRAM,
+		Cycle:       c.cycle,
+		PrevNMILine: c.prevNMILine,
+		NeedNMI:     c.needNMI,
+		PrevNeedNMI: c.prevNeedNMI,
+		RunIRQ:      c.runIRQ,
+		PrevRunIRQ:  c.prevRunIRQ,
+	}
+	if c.jam != nil {
+		jam := *c.jam
+		s.Jam = &jam
+	}
+	return s
+}
+
+//LoadState は SaveState で取った状態に戻す
+func (c *CPU) LoadState(s State) {
+	c.A, c.X, c.Y, c.SP, c.PC = s.A, s.X, s.Y, s.SP, s.PC
+	c.N, c.V, c.R, c.B, c.D, c.I, c.Z, c.C = s.N, s.V, s.R, s.B, s.D, s.I, s.Z, s.C
+	c.wRAM = s.RAM
+	c.cycle = s.Cycle
+	c.prevNMILine = s.PrevNMILine
+	c.needNMI = s.NeedNMI
+	c.prevNeedNMI = s.PrevNeedNMI
+	c.runIRQ = s.RunIRQ
+	c.prevRunIRQ = s.PrevRunIRQ
+	c.jam = nil
+	if s.Jam != nil {
+		jam := *s.Jam
+		c.jam = &jam
+	}
+	return
+}
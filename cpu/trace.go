@@ -0,0 +1,105 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pishiko/gones/disasm"
+)
+
+//Tracer は命令ごとの状態を Nintendulator (nestest.log) と同じ形式で書き出す
+type Tracer struct {
+	w *bufio.Writer
+	//アドレス・フレームの範囲 (両端を含む)．範囲外の命令は書かない
+	fromAddr  uint16
+	toAddr    uint16
+	fromFrame int
+	toFrame   int
+}
+
+//NewTracer は w に書き出すTracerを作る．最初は全ての命令を書く
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{w: bufio.NewWriter(w), toAddr: 0xffff, toFrame: -1}
+}
+
+//SetAddrRange は PC が from-to の命令だけを書くようにする
+func (t *Tracer) SetAddrRange(from, to uint16) {
+	t.fromAddr = from
+	t.toAddr = to
+}
+
+//SetFrameRange は from-to フレーム目だけを書くようにする．to が負なら終わりなし
+func (t *Tracer) SetFrameRange(from, to int) {
+	t.fromFrame = from
+	t.toFrame = to
+}
+
+//Flush は溜まっている出力を書き出す
+func (t *Tracer) Flush() error {
+	return t.w.Flush()
+}
+
+//SetTracer は命令の実行前に t へ書き出すようにする．nil で止める
+func (c *CPU) SetTracer(t *Tracer) {
+	c.tracer = t
+}
+
+func (t *Tracer) trace(c *CPU) {
+	frame := c.ppu.FrameCount
+	if c.PC < t.fromAddr || c.PC > t.toAddr || frame < t.fromFrame || (t.toFrame >= 0 && frame > t.toFrame) {
+		return
+	}
+	in := disasm.Decode(c, c.PC, &disasm.Regs{X: c.X, Y: c.Y})
+	bytes := make([]string, len(in.Bytes))
+	for i, b := range in.Bytes {
+		bytes[i] = fmt.Sprintf("%02X", b)
+	}
+	mark := ' '
+	if in.IsUnofficial {
+		mark = '*'
+	}
+	line, dot := c.ppu.Position()
+	fmt.Fprintf(t.w, "%04X  %-8s %c%-31s A:%02X X:%02X Y:%02X P:%02X SP:%02X PPU:%3d,%3d CYC:%d\n",
+		c.PC, strings.Join(bytes, " "), mark, nestestText(c, in),
+		c.A, c.X, c.Y, c.getP()&0xef|0x20, c.SP, line, dot, c.cycle)
+}
+
+//nestestText は nestest.log と同じく，参照するアドレスと値を添えた逆アセンブル
+func nestestText(c *CPU, in disasm.Instruction) string {
+	mnemonic := in.Mnemonic
+	if mnemonic == "ISC" {
+		//nestest.log での表記
+		mnemonic = "ISB"
+	}
+	op := in.Operand
+	var low uint16
+	if len(in.Bytes) >= 2 {
+		low = uint16(in.Bytes[1])
+	}
+	switch in.Mode {
+	case disasm.ZeroPage:
+		op = fmt.Sprintf("%s = %02X", op, c.Peek(in.Effective))
+	case disasm.ZeroPageX, disasm.ZeroPageY:
+		op = fmt.Sprintf("%s @ %02X = %02X", op, in.Effective, c.Peek(in.Effective))
+	case disasm.Absolute:
+		if mnemonic != "JMP" && mnemonic != "JSR" {
+			op = fmt.Sprintf("%s = %02X", op, c.Peek(in.Effective))
+		}
+	case disasm.AbsoluteX, disasm.AbsoluteY:
+		op = fmt.Sprintf("%s @ %04X = %02X", op, in.Effective, c.Peek(in.Effective))
+	case disasm.Indirect:
+		op = fmt.Sprintf("%s = %04X", op, in.Effective)
+	case disasm.IndirectX:
+		ptr := (low + uint16(c.X)) & 0x00ff
+		op = fmt.Sprintf("%s @ %02X = %04X = %02X", op, ptr, in.Effective, c.Peek(in.Effective))
+	case disasm.IndirectY:
+		base := in.Effective - uint16(c.Y)
+		op = fmt.Sprintf("%s = %04X @ %04X = %02X", op, base, in.Effective, c.Peek(in.Effective))
+	}
+	if op == "" {
+		return mnemonic
+	}
+	return mnemonic + " " + op
+}
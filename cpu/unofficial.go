@@ -0,0 +1,203 @@
+package cpu
+
+import "fmt"
+
+//非公式命令
+//ロード・ストア
+func (c *CPU) LAX(m uint16) {
+	c.A = c.read(m)
+	c.X = c.A
+	c.setNZ(c.A)
+	return
+}
+
+func (c *CPU) SAX(m uint16) {
+	c.write(m, c.A&c.X)
+	return
+}
+
+//LAS は M & SP を A, X, SP に入れる
+func (c *CPU) LAS(m uint16) {
+	c.SP &= c.read(m)
+	c.A = c.SP
+	c.X = c.SP
+	c.setNZ(c.A)
+	return
+}
+
+//読み書き変更 + 演算
+func (c *CPU) SLO(m uint16) {
+	data := c.readModify(m)
+	c.C = data&0x80 != 0x00
+	data = data << 1
+	c.write(m, data)
+	c.A |= data
+	c.setNZ(c.A)
+	return
+}
+
+func (c *CPU) RLA(m uint16) {
+	data := c.readModify(m)
+	futureC := data&0x80 != 0x00
+	data = data << 1
+	if c.C {
+		data += 0x01
+	}
+	c.C = futureC
+	c.write(m, data)
+	c.A &= data
+	c.setNZ(c.A)
+	return
+}
+
+func (c *CPU) SRE(m uint16) {
+	data := c.readModify(m)
+	c.C = data&0x01 != 0x00
+	data = data >> 1
+	c.write(m, data)
+	c.A ^= data
+	c.setNZ(c.A)
+	return
+}
+
+func (c *CPU) RRA(m uint16) {
+	data := c.readModify(m)
+	futureC := data&0x01 != 0x00
+	data = data >> 1
+	if c.C {
+		data += 0x80
+	}
+	c.C = futureC
+	c.write(m, data)
+	c.adc(data)
+	return
+}
+
+func (c *CPU) DCP(m uint16) {
+	data := c.readModify(m) - 0x01
+	c.write(m, data)
+	c.compare(c.A, data)
+	return
+}
+
+func (c *CPU) ISC(m uint16) {
+	data := c.readModify(m) + 0x01
+	c.write(m, data)
+	c.adc(^data)
+	return
+}
+
+//即値
+func (c *CPU) ANC(m uint16) {
+	c.A &= c.read(m)
+	c.setNZ(c.A)
+	c.C = c.N
+	return
+}
+
+func (c *CPU) ALR(m uint16) {
+	c.A &= c.read(m)
+	c.C = c.A&0x01 != 0x00
+	c.A = c.A >> 1
+	c.setNZ(c.A)
+	return
+}
+
+func (c *CPU) ARR(m uint16) {
+	c.A &= c.read(m)
+	c.A = c.A >> 1
+	if c.C {
+		c.A += 0x80
+	}
+	c.setNZ(c.A)
+	c.C = c.A&0x40 != 0x00
+	c.V = (c.A>>6^c.A>>5)&0x01 != 0x00
+	return
+}
+
+//AXS は X = (A & X) - M．フラグはCMPと同じ
+func (c *CPU) AXS(m uint16) {
+	data := c.read(m)
+	ax := c.A & c.X
+	c.compare(ax, data)
+	c.X = ax - data
+	return
+}
+
+//不安定な命令．マジック定数は実機の個体差があるので一般的な値を使う
+func (c *CPU) XAA(m uint16) {
+	c.A = (c.A | 0xee) & c.X & c.read(m)
+	c.setNZ(c.A)
+	return
+}
+
+func (c *CPU) LXA(m uint16) {
+	c.A = (c.A | 0xff) & c.read(m)
+	c.X = c.A
+	c.setNZ(c.A)
+	return
+}
+
+func (c *CPU) AHX(m uint16) {
+	c.storeHigh(m, c.Y, c.A&c.X)
+	return
+}
+
+func (c *CPU) SHX(m uint16) {
+	c.storeHigh(m, c.Y, c.X)
+	return
+}
+
+func (c *CPU) SHY(m uint16) {
+	c.storeHigh(m, c.X, c.Y)
+	return
+}
+
+func (c *CPU) TAS(m uint16) {
+	c.SP = c.A & c.X
+	c.storeHigh(m, c.Y, c.SP)
+	return
+}
+
+//storeHigh は data & (ベースアドレスの上位+1) を書く．
+//ページをまたぐと書き込み先の上位バイトもその値に化ける
+func (c *CPU) storeHigh(addr uint16, index uint8, data uint8) {
+	base := addr - uint16(index)
+	data &= uint8(base>>8) + 0x01
+	if base&0xff00 != addr&0xff00 {
+		addr = uint16(data)<<8 | addr&0x00ff
+	}
+	c.write(addr, data)
+	return
+}
+
+//IGN はオペランドを読むだけのNOP
+func (c *CPU) IGN(m uint16) {
+	c.read(m)
+	return
+}
+
+//JAM はCPUを止める．リセットまで何も実行しない
+func (c *CPU) JAM(_ uint16) {
+	c.PC--
+	c.jam = &JamError{PC: c.PC, Opcode: c.read(c.PC)}
+	return
+}
+
+//JamError はJAM(KIL)命令で止まったときの状態
+type JamError struct {
+	PC     uint16
+	Opcode uint8
+}
+
+func (e *JamError) Error() string {
+	return fmt.Sprintf("cpu: jammed by opcode $%02X at $%04X", e.Opcode, e.PC)
+}
+
+//Jammed はJAM命令で止まっていればその状態を返す
+func (c *CPU) Jammed() error {
+	if c.jam == nil {
+		return nil
+	}
+	return c.jam
+}
@@ -0,0 +1,171 @@
+//Package disasm は6502の命令をバス上のアドレスから逆アセンブルする
+package disasm
+
+import "fmt"
+
+//Mode アドレッシングモード
+type Mode int
+
+const (
+	Implied Mode = iota
+	Accumulator
+	Immediate
+	ZeroPage
+	ZeroPageX
+	ZeroPageY
+	Absolute
+	AbsoluteX
+	AbsoluteY
+	Indirect
+	IndirectX
+	IndirectY
+	Relative
+)
+
+var modeLength = [...]int{
+	Implied:     1,
+	Accumulator: 1,
+	Immediate:   2,
+	ZeroPage:    2,
+	ZeroPageX:   2,
+	ZeroPageY:   2,
+	Absolute:    3,
+	AbsoluteX:   3,
+	AbsoluteY:   3,
+	Indirect:    3,
+	IndirectX:   2,
+	IndirectY:   2,
+	Relative:    2,
+}
+
+//Bus は逆アセンブル対象のアドレス空間．PPUレジスタなどを壊さないよう副作用なしで読む
+type Bus interface {
+	Peek(addr uint16) uint8
+}
+
+//Regs はインデックス付きアドレッシングの実効アドレス計算に使うレジスタ
+type Regs struct {
+	X, Y uint8
+}
+
+//Instruction 1命令分の逆アセンブル結果
+type Instruction struct {
+	Addr         uint16
+	Opcode       uint8
+	Bytes        []uint8
+	Mnemonic     string
+	Mode         Mode
+	IsUnofficial bool
+	//Operand はオペランドの表記 ("#$10", "($20),Y" など)
+	Operand string
+	//Effective は実際にアクセスする(飛ぶ)アドレス．HasEffective が false なら無効
+	Effective    uint16
+	HasEffective bool
+	Length       int
+}
+
+//Decode は addr の命令を読む．regs が nil ならインデックス付きの実効アドレスは求めない
+func Decode(bus Bus, addr uint16, regs *Regs) Instruction {
+	opcode := bus.Peek(addr)
+	op := opcodes[opcode]
+	in := Instruction{
+		Addr:         addr,
+		Opcode:       opcode,
+		Mnemonic:     op.mnemonic,
+		Mode:         op.mode,
+		IsUnofficial: op.isUnofficial,
+		Length:       modeLength[op.mode],
+	}
+	for i := 0; i < in.Length; i++ {
+		in.Bytes = append(in.Bytes, bus.Peek(addr+uint16(i)))
+	}
+	var low, word uint16
+	if in.Length >= 2 {
+		low = uint16(in.Bytes[1])
+		word = low
+	}
+	if in.Length == 3 {
+		word |= uint16(in.Bytes[2]) << 8
+	}
+
+	switch in.Mode {
+	case Accumulator:
+		in.Operand = "A"
+	case Immediate:
+		in.Operand = fmt.Sprintf("#$%02X", low)
+	case ZeroPage:
+		in.Operand = fmt.Sprintf("$%02X", low)
+		in.setEffective(low)
+	case ZeroPageX:
+		in.Operand = fmt.Sprintf("$%02X,X", low)
+		if regs != nil {
+			in.setEffective((low + uint16(regs.X)) & 0x00ff)
+		}
+	case ZeroPageY:
+		in.Operand = fmt.Sprintf("$%02X,Y", low)
+		if regs != nil {
+			in.setEffective((low + uint16(regs.Y)) & 0x00ff)
+		}
+	case Absolute:
+		in.Operand = fmt.Sprintf("$%04X", word)
+		in.setEffective(word)
+	case AbsoluteX:
+		in.Operand = fmt.Sprintf("$%04X,X", word)
+		if regs != nil {
+			in.setEffective(word + uint16(regs.X))
+		}
+	case AbsoluteY:
+		in.Operand = fmt.Sprintf("$%04X,Y", word)
+		if regs != nil {
+			in.setEffective(word + uint16(regs.Y))
+		}
+	case Indirect:
+		in.Operand = fmt.Sprintf("($%04X)", word)
+		//JMP ($xxFF) はページをまたがず $xx00 から上位を読む
+		in.setEffective(peek16(bus, word, word&0xff00|(word+1)&0x00ff))
+	case IndirectX:
+		in.Operand = fmt.Sprintf("($%02X,X)", low)
+		if regs != nil {
+			ptr := (low + uint16(regs.X)) & 0x00ff
+			in.setEffective(peek16(bus, ptr, (ptr+1)&0x00ff))
+		}
+	case IndirectY:
+		in.Operand = fmt.Sprintf("($%02X),Y", low)
+		if regs != nil {
+			in.setEffective(peek16(bus, low, (low+1)&0x00ff) + uint16(regs.Y))
+		}
+	case Relative:
+		target := addr + 2 + uint16(int8(low))
+		in.Operand = fmt.Sprintf("$%04X", target)
+		in.setEffective(target)
+	}
+	return in
+}
+
+func (in *Instruction) setEffective(addr uint16) {
+	in.Effective = addr
+	in.HasEffective = true
+}
+
+func peek16(bus Bus, lowAddr, highAddr uint16) uint16 {
+	return uint16(bus.Peek(highAddr))<<8 | uint16(bus.Peek(lowAddr))
+}
+
+//String は "LDA $0200,X" の形にする
+func (in Instruction) String() string {
+	if in.Operand == "" {
+		return in.Mnemonic
+	}
+	return in.Mnemonic + " " + in.Operand
+}
+
+//Range は addr から n 命令を順に逆アセンブルする
+func Range(bus Bus, addr uint16, n int) []Instruction {
+	list := make([]Instruction, 0, n)
+	for i := 0; i < n; i++ {
+		in := Decode(bus, addr, nil)
+		list = append(list, in)
+		addr += uint16(in.Length)
+	}
+	return list
+}
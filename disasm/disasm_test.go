@@ -0,0 +1,81 @@
+package disasm
+
+import "testing"
+
+//memBus は64KBのRAMだけのバス
+type memBus [0x10000]uint8
+
+func (m *memBus) Peek(addr uint16) uint8 {
+	return m[addr]
+}
+
+func TestDecode(t *testing.T) {
+	bus := &memBus{}
+	//ポインタ: $10/$11 -> $0234, $FF/$00 -> $0456 (ゼロページで折り返す)
+	bus[0x10], bus[0x11] = 0x34, 0x02
+	bus[0xff], bus[0x00] = 0x56, 0x04
+	//JMP ($02FF) は $02FF と $0200 から読む
+	bus[0x02ff], bus[0x0200], bus[0x0300] = 0x78, 0x9a, 0xee
+	regs := &Regs{X: 0x05, Y: 0x10}
+
+	tests := []struct {
+		code         []uint8
+		text         string
+		length       int
+		effective    int
+		isUnofficial bool
+	}{
+		{[]uint8{0xea}, "NOP", 1, -1, false},
+		{[]uint8{0x0a}, "ASL A", 1, -1, false},
+		{[]uint8{0xa9, 0x7f}, "LDA #$7F", 2, -1, false},
+		{[]uint8{0xa5, 0x44}, "LDA $44", 2, 0x0044, false},
+		{[]uint8{0xb5, 0xfe}, "LDA $FE,X", 2, 0x0003, false},
+		{[]uint8{0xb6, 0x20}, "LDX $20,Y", 2, 0x0030, false},
+		{[]uint8{0xad, 0x00, 0x20}, "LDA $2000", 3, 0x2000, false},
+		{[]uint8{0xbd, 0xff, 0x02}, "LDA $02FF,X", 3, 0x0304, false},
+		{[]uint8{0xb9, 0xf8, 0xff}, "LDA $FFF8,Y", 3, 0x0008, false},
+		{[]uint8{0x6c, 0xff, 0x02}, "JMP ($02FF)", 3, 0x9a78, false},
+		{[]uint8{0xa1, 0x0b}, "LDA ($0B,X)", 2, 0x0234, false},
+		{[]uint8{0xa1, 0xfa}, "LDA ($FA,X)", 2, 0x0456, false},
+		{[]uint8{0xb1, 0xff}, "LDA ($FF),Y", 2, 0x0466, false},
+		{[]uint8{0xa7, 0x44}, "LAX $44", 2, 0x0044, true},
+		{[]uint8{0x02}, "JAM", 1, -1, true},
+	}
+	for _, tt := range tests {
+		copy(bus[0x8000:], tt.code)
+		in := Decode(bus, 0x8000, regs)
+		if in.String() != tt.text || in.Length != tt.length || in.IsUnofficial != tt.isUnofficial {
+			t.Errorf("% X: got %q length %d unofficial %v, want %q length %d unofficial %v",
+				tt.code, in.String(), in.Length, in.IsUnofficial, tt.text, tt.length, tt.isUnofficial)
+		}
+		if len(in.Bytes) != tt.length || in.Bytes[0] != tt.code[0] {
+			t.Errorf("% X: bytes % X", tt.code, in.Bytes)
+		}
+		if tt.effective < 0 {
+			if in.HasEffective {
+				t.Errorf("% X: unexpected effective address $%04X", tt.code, in.Effective)
+			}
+		} else if !in.HasEffective || in.Effective != uint16(tt.effective) {
+			t.Errorf("% X: effective $%04X (%v), want $%04X", tt.code, in.Effective, in.HasEffective, tt.effective)
+		}
+	}
+}
+
+func TestDecodeWithoutRegs(t *testing.T) {
+	bus := &memBus{}
+	copy(bus[0x8000:], []uint8{0xbd, 0x00, 0x02})
+	if in := Decode(bus, 0x8000, nil); in.HasEffective {
+		t.Errorf("%s: effective address $%04X without registers", in, in.Effective)
+	}
+}
+
+func TestRelative(t *testing.T) {
+	bus := &memBus{}
+	copy(bus[0x8000:], []uint8{0xd0, 0xfe, 0xf0, 0x7f, 0x10, 0x80})
+	want := []string{"BNE $8000", "BEQ $8083", "BPL $7F86"}
+	for i, in := range Range(bus, 0x8000, 3) {
+		if in.String() != want[i] {
+			t.Errorf("%d: got %q, want %q", i, in, want[i])
+		}
+	}
+}
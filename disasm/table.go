@@ -0,0 +1,73 @@
+package disasm
+
+//opcodes 命令ごとのニーモニック・アドレッシングモード・非公式命令か
+var opcodes = [256]struct {
+	mnemonic     string
+	mode         Mode
+	isUnofficial bool
+}{
+	/*0x00*/ {"BRK", Implied, false}, {"ORA", IndirectX, false}, {"JAM", Implied, true}, {"SLO", IndirectX, true},
+	/*0x04*/ {"NOP", ZeroPage, true}, {"ORA", ZeroPage, false}, {"ASL", ZeroPage, false}, {"SLO", ZeroPage, true},
+	/*0x08*/ {"PHP", Implied, false}, {"ORA", Immediate, false}, {"ASL", Accumulator, false}, {"ANC", Immediate, true},
+	/*0x0C*/ {"NOP", Absolute, true}, {"ORA", Absolute, false}, {"ASL", Absolute, false}, {"SLO", Absolute, true},
+	/*0x10*/ {"BPL", Relative, false}, {"ORA", IndirectY, false}, {"JAM", Implied, true}, {"SLO", IndirectY, true},
+	/*0x14*/ {"NOP", ZeroPageX, true}, {"ORA", ZeroPageX, false}, {"ASL", ZeroPageX, false}, {"SLO", ZeroPageX, true},
+	/*0x18*/ {"CLC", Implied, false}, {"ORA", AbsoluteY, false}, {"NOP", Implied, true}, {"SLO", AbsoluteY, true},
+	/*0x1C*/ {"NOP", AbsoluteX, true}, {"ORA", AbsoluteX, false}, {"ASL", AbsoluteX, false}, {"SLO", AbsoluteX, true},
+	/*0x20*/ {"JSR", Absolute, false}, {"AND", IndirectX, false}, {"JAM", Implied, true}, {"RLA", IndirectX, true},
+	/*0x24*/ {"BIT", ZeroPage, false}, {"AND", ZeroPage, false}, {"ROL", ZeroPage, false}, {"RLA", ZeroPage, true},
+	/*0x28*/ {"PLP", Implied, false}, {"AND", Immediate, false}, {"ROL", Accumulator, false}, {"ANC", Immediate, true},
+	/*0x2C*/ {"BIT", Absolute, false}, {"AND", Absolute, false}, {"ROL", Absolute, false}, {"RLA", Absolute, true},
+	/*0x30*/ {"BMI", Relative, false}, {"AND", IndirectY, false}, {"JAM", Implied, true}, {"RLA", IndirectY, true},
+	/*0x34*/ {"NOP", ZeroPageX, true}, {"AND", ZeroPageX, false}, {"ROL", ZeroPageX, false}, {"RLA", ZeroPageX, true},
+	/*0x38*/ {"SEC", Implied, false}, {"AND", AbsoluteY, false}, {"NOP", Implied, true}, {"RLA", AbsoluteY, true},
+	/*0x3C*/ {"NOP", AbsoluteX, true}, {"AND", AbsoluteX, false}, {"ROL", AbsoluteX, false}, {"RLA", AbsoluteX, true},
+	/*0x40*/ {"RTI", Implied, false}, {"EOR", IndirectX, false}, {"JAM", Implied, true}, {"SRE", IndirectX, true},
+	/*0x44*/ {"NOP", ZeroPage, true}, {"EOR", ZeroPage, false}, {"LSR", ZeroPage, false}, {"SRE", ZeroPage, true},
+	/*0x48*/ {"PHA", Implied, false}, {"EOR", Immediate, false}, {"LSR", Accumulator, false}, {"ALR", Immediate, true},
+	/*0x4C*/ {"JMP", Absolute, false}, {"EOR", Absolute, false}, {"LSR", Absolute, false}, {"SRE", Absolute, true},
+	/*0x50*/ {"BVC", Relative, false}, {"EOR", IndirectY, false}, {"JAM", Implied, true}, {"SRE", IndirectY, true},
+	/*0x54*/ {"NOP", ZeroPageX, true}, {"EOR", ZeroPageX, false}, {"LSR", ZeroPageX, false}, {"SRE", ZeroPageX, true},
+	/*0x58*/ {"CLI", Implied, false}, {"EOR", AbsoluteY, false}, {"NOP", Implied, true}, {"SRE", AbsoluteY, true},
+	/*0x5C*/ {"NOP", AbsoluteX, true}, {"EOR", AbsoluteX, false}, {"LSR", AbsoluteX, false}, {"SRE", AbsoluteX, true},
+	/*0x60*/ {"RTS", Implied, false}, {"ADC", IndirectX, false}, {"JAM", Implied, true}, {"RRA", IndirectX, true},
+	/*0x64*/ {"NOP", ZeroPage, true}, {"ADC", ZeroPage, false}, {"ROR", ZeroPage, false}, {"RRA", ZeroPage, true},
+	/*0x68*/ {"PLA", Implied, false}, {"ADC", Immediate, false}, {"ROR", Accumulator, false}, {"ARR", Immediate, true},
+	/*0x6C*/ {"JMP", Indirect, false}, {"ADC", Absolute, false}, {"ROR", Absolute, false}, {"RRA", Absolute, true},
+	/*0x70*/ {"BVS", Relative, false}, {"ADC", IndirectY, false}, {"JAM", Implied, true}, {"RRA", IndirectY, true},
+	/*0x74*/ {"NOP", ZeroPageX, true}, {"ADC", ZeroPageX, false}, {"ROR", ZeroPageX, false}, {"RRA", ZeroPageX, true},
+	/*0x78*/ {"SEI", Implied, false}, {"ADC", AbsoluteY, false}, {"NOP", Implied, true}, {"RRA", AbsoluteY, true},
+	/*0x7C*/ {"NOP", AbsoluteX, true}, {"ADC", AbsoluteX, false}, {"ROR", AbsoluteX, false}, {"RRA", AbsoluteX, true},
+	/*0x80*/ {"NOP", Immediate, true}, {"STA", IndirectX, false}, {"NOP", Immediate, true}, {"SAX", IndirectX, true},
+	/*0x84*/ {"STY", ZeroPage, false}, {"STA", ZeroPage, false}, {"STX", ZeroPage, false}, {"SAX", ZeroPage, true},
+	/*0x88*/ {"DEY", Implied, false}, {"NOP", Immediate, true}, {"TXA", Implied, false}, {"XAA", Immediate, true},
+	/*0x8C*/ {"STY", Absolute, false}, {"STA", Absolute, false}, {"STX", Absolute, false}, {"SAX", Absolute, true},
+	/*0x90*/ {"BCC", Relative, false}, {"STA", IndirectY, false}, {"JAM", Implied, true}, {"AHX", IndirectY, true},
+	/*0x94*/ {"STY", ZeroPageX, false}, {"STA", ZeroPageX, false}, {"STX", ZeroPageY, false}, {"SAX", ZeroPageY, true},
+	/*0x98*/ {"TYA", Implied, false}, {"STA", AbsoluteY, false}, {"TXS", Implied, false}, {"TAS", AbsoluteY, true},
+	/*0x9C*/ {"SHY", AbsoluteX, true}, {"STA", AbsoluteX, false}, {"SHX", AbsoluteY, true}, {"AHX", AbsoluteY, true},
+	/*0xA0*/ {"LDY", Immediate, false}, {"LDA", IndirectX, false}, {"LDX", Immediate, false}, {"LAX", IndirectX, true},
+	/*0xA4*/ {"LDY", ZeroPage, false}, {"LDA", ZeroPage, false}, {"LDX", ZeroPage, false}, {"LAX", ZeroPage, true},
+	/*0xA8*/ {"TAY", Implied, false}, {"LDA", Immediate, false}, {"TAX", Implied, false}, {"LXA", Immediate, true},
+	/*0xAC*/ {"LDY", Absolute, false}, {"LDA", Absolute, false}, {"LDX", Absolute, false}, {"LAX", Absolute, true},
+	/*0xB0*/ {"BCS", Relative, false}, {"LDA", IndirectY, false}, {"JAM", Implied, true}, {"LAX", IndirectY, true},
+	/*0xB4*/ {"LDY", ZeroPageX, false}, {"LDA", ZeroPageX, false}, {"LDX", ZeroPageY, false}, {"LAX", ZeroPageY, true},
+	/*0xB8*/ {"CLV", Implied, false}, {"LDA", AbsoluteY, false}, {"TSX", Implied, false}, {"LAS", AbsoluteY, true},
+	/*0xBC*/ {"LDY", AbsoluteX, false}, {"LDA", AbsoluteX, false}, {"LDX", AbsoluteY, false}, {"LAX", AbsoluteY, true},
+	/*0xC0*/ {"CPY", Immediate, false}, {"CMP", IndirectX, false}, {"NOP", Immediate, true}, {"DCP", IndirectX, true},
+	/*0xC4*/ {"CPY", ZeroPage, false}, {"CMP", ZeroPage, false}, {"DEC", ZeroPage, false}, {"DCP", ZeroPage, true},
+	/*0xC8*/ {"INY", Implied, false}, {"CMP", Immediate, false}, {"DEX", Implied, false}, {"AXS", Immediate, true},
+	/*0xCC*/ {"CPY", Absolute, false}, {"CMP", Absolute, false}, {"DEC", Absolute, false}, {"DCP", Absolute, true},
+	/*0xD0*/ {"BNE", Relative, false}, {"CMP", IndirectY, false}, {"JAM", Implied, true}, {"DCP", IndirectY, true},
+	/*0xD4*/ {"NOP", ZeroPageX, true}, {"CMP", ZeroPageX, false}, {"DEC", ZeroPageX, false}, {"DCP", ZeroPageX, true},
+	/*0xD8*/ {"CLD", Implied, false}, {"CMP", AbsoluteY, false}, {"NOP", Implied, true}, {"DCP", AbsoluteY, true},
+	/*0xDC*/ {"NOP", AbsoluteX, true}, {"CMP", AbsoluteX, false}, {"DEC", AbsoluteX, false}, {"DCP", AbsoluteX, true},
+	/*0xE0*/ {"CPX", Immediate, false}, {"SBC", IndirectX, false}, {"NOP", Immediate, true}, {"ISC", IndirectX, true},
+	/*0xE4*/ {"CPX", ZeroPage, false}, {"SBC", ZeroPage, false}, {"INC", ZeroPage, false}, {"ISC", ZeroPage, true},
+	/*0xE8*/ {"INX", Implied, false}, {"SBC", Immediate, false}, {"NOP", Implied, false}, {"SBC", Immediate, true},
+	/*0xEC*/ {"CPX", Absolute, false}, {"SBC", Absolute, false}, {"INC", Absolute, false}, {"ISC", Absolute, true},
+	/*0xF0*/ {"BEQ", Relative, false}, {"SBC", IndirectY, false}, {"JAM", Implied, true}, {"ISC", IndirectY, true},
+	/*0xF4*/ {"NOP", ZeroPageX, true}, {"SBC", ZeroPageX, false}, {"INC", ZeroPageX, false}, {"ISC", ZeroPageX, true},
+	/*0xF8*/ {"SED", Implied, false}, {"SBC", AbsoluteY, false}, {"NOP", Implied, true}, {"ISC", AbsoluteY, true},
+	/*0xFC*/ {"NOP", AbsoluteX, true}, {"SBC", AbsoluteX, false}, {"INC", AbsoluteX, false}, {"ISC", AbsoluteX, true},
+}
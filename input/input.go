@@ -0,0 +1,85 @@
+//Package input は $4016/$4017 のコントローラ端子とそこにつなぐ機器
+package input
+
+//Button は標準コントローラのボタン．シリアルで読み出される順に並ぶ
+type Button int
+
+const (
+	ButtonA Button = iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+//Buttons は押されているボタン．添字は Button
+type Buttons [8]bool
+
+//Or は b と o のどちらかで押されているボタン
+func (b Buttons) Or(o Buttons) Buttons {
+	for i := range b {
+		b[i] = b[i] || o[i]
+	}
+	return b
+}
+
+//Controller はコントローラ端子につなぐ機器
+type Controller interface {
+	//Strobe は $4016 bit0 (OUT0) の書き込み
+	Strobe(on bool)
+	//Read は $4016/$4017 の読み出し1回分．下位5bit(D0-D4)だけが使われる
+	Read() uint8
+}
+
+//Ports は本体の2つのコントローラ端子．ポート1が $4016，ポート2が $4017
+type Ports struct {
+	controllers [2]Controller
+}
+
+//NewPorts は両方の端子に標準コントローラをつないだ状態を作る
+func NewPorts() *Ports {
+	p := &Ports{}
+	p.Connect(0, NewStandard())
+	p.Connect(1, NewStandard())
+	return p
+}
+
+//Connect は port (0か1) に c をつなぐ．nil なら外す
+func (p *Ports) Connect(port int, c Controller) {
+	p.controllers[port] = c
+}
+
+//Controller は port につながっている機器
+func (p *Ports) Controller(port int) Controller {
+	return p.controllers[port]
+}
+
+//SetButtons は標準コントローラがつながっている端子のボタンを変える
+func (p *Ports) SetButtons(pads [2]Buttons) {
+	for i, c := range p.controllers {
+		if s, ok := c.(*Standard); ok {
+			s.SetButtons(pads[i])
+		}
+	}
+}
+
+//Write は $4016 への書き込み．OUT0 は両方の端子に出ている
+func (p *Ports) Write(data uint8) {
+	for _, c := range p.controllers {
+		if c != nil {
+			c.Strobe(data&0x01 != 0x00)
+		}
+	}
+}
+
+//Read は port の読み出し．上位3bitは駆動されないので openBus (直前にバスに乗った値) が見える
+func (p *Ports) Read(port int, openBus uint8) uint8 {
+	data := openBus & 0xe0
+	if c := p.controllers[port]; c != nil {
+		data |= c.Read() & 0x1f
+	}
+	return data
+}
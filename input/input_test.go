@@ -0,0 +1,96 @@
+package input
+
+import "testing"
+
+//readBits は port を n 回読んだ bit0 の列
+func readBits(p *Ports, port, n int) []uint8 {
+	bits := make([]uint8, n)
+	for i := range bits {
+		bits[i] = p.Read(port, 0x40) & 0x01
+	}
+	return bits
+}
+
+func equalBits(a, b []uint8) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStandardShiftRegister(t *testing.T) {
+	p := NewPorts()
+	var pads [2]Buttons
+	pads[0][ButtonA] = true
+	pads[0][ButtonStart] = true
+	pads[1][ButtonRight] = true
+	p.SetButtons(pads)
+	p.Write(0x01)
+	p.Write(0x00)
+
+	//A B Select Start Up Down Left Right の順，8回読んだ後は1
+	if got, want := readBits(p, 0, 10), []uint8{1, 0, 0, 1, 0, 0, 0, 0, 1, 1}; !equalBits(got, want) {
+		t.Errorf("port 1: %v, want %v", got, want)
+	}
+	if got, want := readBits(p, 1, 10), []uint8{0, 0, 0, 0, 0, 0, 0, 1, 1, 1}; !equalBits(got, want) {
+		t.Errorf("port 2: %v, want %v", got, want)
+	}
+}
+
+func TestStandardStrobe(t *testing.T) {
+	p := NewPorts()
+	var pads [2]Buttons
+	pads[0][ButtonA] = true
+	p.SetButtons(pads)
+
+	//ストローブ中は何度読んでもAの状態
+	p.Write(0x01)
+	if got := readBits(p, 0, 3); !equalBits(got, []uint8{1, 1, 1}) {
+		t.Errorf("strobe high: %v", got)
+	}
+	pads[0][ButtonA] = false
+	p.SetButtons(pads)
+	if got := readBits(p, 0, 1); got[0] != 0 {
+		t.Error("strobe high does not follow the buttons")
+	}
+
+	//ストローブを下げた後のボタンの変化は次のラッチまで見えない
+	pads[0][ButtonB] = true
+	p.SetButtons(pads)
+	p.Write(0x00)
+	pads[0][ButtonB] = false
+	p.SetButtons(pads)
+	if got := readBits(p, 0, 2); !equalBits(got, []uint8{0, 1}) {
+		t.Errorf("latched: %v, want [0 1]", got)
+	}
+	p.Write(0x01)
+	p.Write(0x00)
+	if got := readBits(p, 0, 2); !equalBits(got, []uint8{0, 0}) {
+		t.Errorf("relatched: %v, want [0 0]", got)
+	}
+}
+
+func TestPortsOpenBus(t *testing.T) {
+	p := NewPorts()
+	var pads [2]Buttons
+	pads[0][ButtonA] = true
+	p.SetButtons(pads)
+	p.Write(0x01)
+	p.Write(0x00)
+	//上位3bitは直前のバスの値，下位5bitはコントローラ
+	if got := p.Read(0, 0x5f); got != 0x41 {
+		t.Errorf("read = $%02X, want $41", got)
+	}
+	if got := p.Read(1, 0xff); got != 0xe0 {
+		t.Errorf("read = $%02X, want $E0", got)
+	}
+	p.Connect(1, nil)
+	if got := p.Read(1, 0x40); got != 0x40 {
+		t.Errorf("unconnected read = $%02X, want $40", got)
+	}
+}
@@ -0,0 +1,76 @@
+package input
+
+//MacroStep はマクロの1段．Buttons を Frames フレーム押し続ける
+type MacroStep struct {
+	Buttons Buttons
+	Frames  int
+}
+
+//Macro は決まった順にボタンを押す入力の列
+type Macro struct {
+	steps  []MacroStep
+	isLoop bool
+	//再生中の位置
+	isRunning bool
+	step      int
+	frame     int
+}
+
+//NewMacro は steps を順に再生するマクロを作る．isLoop なら止めるまで繰り返す
+func NewMacro(steps []MacroStep, isLoop bool) *Macro {
+	return &Macro{steps: steps, isLoop: isLoop}
+}
+
+//Trigger は頭から再生する．繰り返すマクロは再生中なら止める
+func (m *Macro) Trigger() {
+	if m.isLoop && m.isRunning {
+		m.isRunning = false
+		return
+	}
+	if len(m.steps) == 0 {
+		return
+	}
+	m.isRunning = true
+	m.step = 0
+	m.frame = 0
+	m.skipEmpty()
+}
+
+//Next は今のフレームで押すボタンを返して1フレーム進める．再生していなければ false
+func (m *Macro) Next() (Buttons, bool) {
+	if !m.isRunning {
+		return Buttons{}, false
+	}
+	buttons := m.steps[m.step].Buttons
+	m.frame++
+	if m.frame >= m.steps[m.step].Frames {
+		m.frame = 0
+		m.step++
+		m.skipEmpty()
+	}
+	return buttons, true
+}
+
+//skipEmpty は0フレームの段を飛ばし，最後まで来たら止めるか頭に戻る
+func (m *Macro) skipEmpty() {
+	for passes := 0; m.isRunning; {
+		if m.step >= len(m.steps) {
+			if !m.isLoop || passes > 0 {
+				m.isRunning = false
+				return
+			}
+			m.step = 0
+			passes++
+			continue
+		}
+		if m.steps[m.step].Frames > 0 {
+			return
+		}
+		m.step++
+	}
+}
+
+//IsRunning は再生中なら true
+func (m *Macro) IsRunning() bool {
+	return m.isRunning
+}
@@ -0,0 +1,68 @@
+package input
+
+import "testing"
+
+//macroFrames はマクロを n フレーム進めて，各フレームで押したボタン (A=a, B=b) を並べる
+func macroFrames(m *Macro, n int) string {
+	s := ""
+	for i := 0; i < n; i++ {
+		buttons, ok := m.Next()
+		switch {
+		case !ok:
+			s += "_"
+		case buttons[ButtonA]:
+			s += "a"
+		case buttons[ButtonB]:
+			s += "b"
+		default:
+			s += "."
+		}
+	}
+	return s
+}
+
+func TestMacro(t *testing.T) {
+	var a, b Buttons
+	a[ButtonA] = true
+	b[ButtonB] = true
+	steps := []MacroStep{{a, 2}, {Buttons{}, 0}, {Buttons{}, 1}, {b, 1}}
+
+	m := NewMacro(steps, false)
+	if got := macroFrames(m, 3); got != "___" {
+		t.Errorf("before trigger: %s", got)
+	}
+	m.Trigger()
+	if got := macroFrames(m, 6); got != "aa.b__" {
+		t.Errorf("once: %s", got)
+	}
+	//再生中にもう一度押すと頭からやり直す
+	m.Trigger()
+	macroFrames(m, 1)
+	m.Trigger()
+	if got := macroFrames(m, 5); got != "aa.b_" {
+		t.Errorf("retrigger: %s", got)
+	}
+
+	loop := NewMacro(steps, true)
+	loop.Trigger()
+	if got := macroFrames(loop, 9); got != "aa.baa.ba" {
+		t.Errorf("loop: %s", got)
+	}
+	//繰り返すマクロはもう一度押すと止まる
+	loop.Trigger()
+	if got := macroFrames(loop, 2); got != "__" || loop.IsRunning() {
+		t.Errorf("stopped loop: %s", got)
+	}
+}
+
+func TestEmptyMacro(t *testing.T) {
+	for _, steps := range [][]MacroStep{nil, {{Frames: 0}, {Frames: 0}}} {
+		for _, isLoop := range []bool{false, true} {
+			m := NewMacro(steps, isLoop)
+			m.Trigger()
+			if got := macroFrames(m, 2); got != "__" || m.IsRunning() {
+				t.Errorf("%d steps, loop %v: %s", len(steps), isLoop, got)
+			}
+		}
+	}
+}
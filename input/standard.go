@@ -0,0 +1,47 @@
+package input
+
+//Standard は標準コントローラ．4021 シフトレジスタでボタンを1bitずつ返す
+type Standard struct {
+	buttons  Buttons
+	shift    uint8
+	isStrobe bool
+}
+
+//NewStandard は何も押していない標準コントローラを作る
+func NewStandard() *Standard {
+	return &Standard{}
+}
+
+//SetButtons は押されているボタンを変える．ストローブ中でなければ次のラッチまで読み出しには出ない
+func (s *Standard) SetButtons(b Buttons) {
+	s.buttons = b
+}
+
+//Strobe は High の間ボタンをラッチし続け，Low になったところの状態を読み出す
+func (s *Standard) Strobe(on bool) {
+	if on || s.isStrobe {
+		s.latch()
+	}
+	s.isStrobe = on
+}
+
+//Read はシフトレジスタの先頭を返してずらす．8bit 読み終わった後は1が続く
+func (s *Standard) Read() uint8 {
+	if s.isStrobe {
+		s.latch()
+		return s.shift & 0x01
+	}
+	ret := s.shift & 0x01
+	s.shift = s.shift>>1 | 0x80
+	return ret
+}
+
+func (s *Standard) latch() {
+	s.shift = 0
+	for i := len(s.buttons) - 1; i >= 0; i-- {
+		s.shift <<= 1
+		if s.buttons[i] {
+			s.shift |= 0x01
+		}
+	}
+}
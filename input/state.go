@@ -0,0 +1,35 @@
+package input
+
+//State はセーブステートに書き出す端子の状態．標準コントローラ以外の端子は nil
+type State struct {
+	Standard [2]*StandardState
+}
+
+//StandardState は標準コントローラの状態
+type StandardState struct {
+	Buttons  Buttons
+	Shift    uint8
+	IsStrobe bool
+}
+
+//SaveState は現在の状態を返す
+func (p *Ports) SaveState() State {
+	var s State
+	for i, c := range p.controllers {
+		if std, ok := c.(*Standard); ok {
+			s.Standard[i] = &StandardState{std.buttons, std.shift, std.isStrobe}
+		}
+	}
+	return s
+}
+
+//LoadState は SaveState で取った状態に戻す．つながっている機器が違う端子はそのまま
+func (p *Ports) LoadState(s State) {
+	for i, c := range p.controllers {
+		if std, ok := c.(*Standard); ok && s.Standard[i] != nil {
+			std.buttons = s.Standard[i].Buttons
+			std.shift = s.Standard[i].Shift
+			std.isStrobe = s.Standard[i].IsStrobe
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package input
+
+import "fmt"
+
+//framesPerSecond NTSC の1秒あたりのフレーム数 (連射の周期の計算用)
+const framesPerSecond = 60
+
+//Turbo は連射．フレーム番号で位相を決めるので，いつ押し始めても同じフレームで切り替わる
+type Turbo struct {
+	//period は押す・離すの1周期のフレーム数
+	period int
+}
+
+//NewTurbo は1秒に rate 回押す連射を作る．rate は60を割り切る30以下の値 (30, 20, 15, 10 など)
+func NewTurbo(rate int) (*Turbo, error) {
+	if rate <= 0 || rate > framesPerSecond/2 || framesPerSecond%rate != 0 {
+		return nil, fmt.Errorf("input: turbo rate %d Hz must divide %d and be at most %d", rate, framesPerSecond, framesPerSecond/2)
+	}
+	return &Turbo{period: framesPerSecond / rate}, nil
+}
+
+//Pressed は frame で押している側なら true．周期が奇数なら押す側を1フレーム長くする
+func (t *Turbo) Pressed(frame int) bool {
+	return frame%t.period < (t.period+1)/2
+}
@@ -0,0 +1,37 @@
+package input
+
+import "testing"
+
+func TestTurbo(t *testing.T) {
+	tests := []struct {
+		rate int
+		want string
+	}{
+		{30, "X.X.X.X.X.X."},
+		{20, "XX.XX.XX.XX."},
+		{15, "XX..XX..XX.."},
+		{12, "XXX..XXX..XX"},
+	}
+	for _, tt := range tests {
+		turbo, err := NewTurbo(tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		for frame := 0; frame < len(tt.want); frame++ {
+			if turbo.Pressed(frame) {
+				got += "X"
+			} else {
+				got += "."
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%d Hz: %s, want %s", tt.rate, got, tt.want)
+		}
+	}
+	for _, rate := range []int{0, -1, 7, 60} {
+		if _, err := NewTurbo(rate); err == nil {
+			t.Errorf("%d Hz: no error", rate)
+		}
+	}
+}
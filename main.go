@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 )
 
 func main() {
@@ -10,11 +11,61 @@ func main() {
 		fmt.Println("Need NES ROM.")
 		return
 	}
-	nes := NewNES(os.Args[1])
-	for _, a := range os.Args {
+	nes, err := NewNES(os.Args[1])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for i, a := range os.Args {
 		if a == "--debug" || a == "-d" {
 			nes.SetDebug()
 		}
+		if a == "--mmc3-rev-a" {
+			nes.SetMMC3RevA()
+		}
+		if a == "--config" && i+1 < len(os.Args) {
+			if err := nes.LoadConfig(os.Args[i+1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		if a == "--volume" && i+1 < len(os.Args) {
+			v, err := strconv.ParseFloat(os.Args[i+1], 64)
+			if err != nil {
+				fmt.Println("--volume:", err)
+				return
+			}
+			nes.SetVolume(v)
+		}
+		if a == "--rewind-mb" && i+1 < len(os.Args) {
+			mb, err := strconv.Atoi(os.Args[i+1])
+			if err != nil {
+				fmt.Println("--rewind-mb:", err)
+				return
+			}
+			nes.SetRewindMB(mb)
+		}
+		if a == "--movie" && i+1 < len(os.Args) {
+			nes.SetMoviePath(os.Args[i+1])
+		}
+		if a == "--play-movie" && i+1 < len(os.Args) {
+			if err := nes.PlayMovie(os.Args[i+1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		if a == "--record-movie" && i+1 < len(os.Args) {
+			if err := nes.RecordMovie(os.Args[i+1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		if a == "--state" && i+1 < len(os.Args) {
+			if err := nes.SetStatePath(os.Args[i+1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
 	}
 	nes.Run()
 }
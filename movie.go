@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pishiko/gones/console"
+	"github.com/pishiko/gones/movie"
+)
+
+//startRecording は入力の記録を始める．fromPowerOn なら電源を入れ直し，
+//そうでなければ今の状態をムービーに入れてそこから記録する
+func (n *NES) startRecording(fromPowerOn bool) error {
+	n.stopMovie()
+	m := movie.New(n.console.Cartridge, filepath.Base(n.romPath))
+	if fromPowerOn {
+		if err := n.powerOn(); err != nil {
+			return err
+		}
+	} else {
+		var buf bytes.Buffer
+		if err := n.console.SaveState(&buf); err != nil {
+			return err
+		}
+		m.SaveState = buf.Bytes()
+	}
+	n.movie = m
+	n.movieStart = n.console.PPU.FrameCount
+	n.isMovieRecording = true
+	return nil
+}
+
+//startPlayback は path のムービーを読み，記録を始めたときの状態から再生する
+func (n *NES) startPlayback(path string) error {
+	n.stopMovie()
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	m, err := movie.Read(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if sum := movie.Checksum(n.console.Cartridge); m.ROMChecksum != sum {
+		return fmt.Errorf("%s: recorded with ROM %s, loaded %s", path, m.ROMChecksum, sum)
+	}
+	if m.SaveState != nil {
+		if err := n.console.LoadState(bytes.NewReader(m.SaveState)); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if n.rewinder != nil {
+			n.rewinder.Cut()
+		}
+	} else if err := n.powerOn(); err != nil {
+		return err
+	}
+	n.movie = m
+	n.movieStart = n.console.PPU.FrameCount
+	n.isMoviePlaying = true
+	return nil
+}
+
+//stopMovie は記録・再生を止める．記録中ならファイルに書き出す
+func (n *NES) stopMovie() {
+	if n.isMovieRecording {
+		if err := n.saveMovie(); err != nil {
+			log.Println(err)
+		}
+	}
+	n.isMovieRecording = false
+	n.isMoviePlaying = false
+	//電源を入れ直して始めたムービーなら，.sav につながった元のコンソールに戻す
+	if n.preMovie != nil {
+		n.setConsole(n.preMovie)
+		n.preMovie = nil
+	}
+}
+
+//saveMovie は記録したムービーを moviePath に書き出す
+func (n *NES) saveMovie() error {
+	tmp := n.moviePath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = n.movie.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, n.moviePath)
+}
+
+//movieFrame はムービーの中で次に進めるフレームの番号．巻き戻すと小さくなる
+func (n *NES) movieFrame() int {
+	return n.console.PPU.FrameCount - n.movieStart
+}
+
+//sampleMovie は1フレーム分の入力をムービーと突き合わせる．
+//再生中はムービーの入力に置き換え，記録中は巻き戻した先から撮り直して追記する
+func (n *NES) sampleMovie() {
+	frame := n.movieFrame()
+	if frame < 0 {
+		//記録を始める前まで巻き戻した
+		n.stopMovie()
+		n.showMessage("MOVIE STOPPED")
+		return
+	}
+	switch {
+	case n.isMoviePlaying:
+		if frame >= len(n.movie.Frames) {
+			n.stopMovie()
+			n.showMessage("MOVIE END")
+			return
+		}
+		f := n.movie.Frames[frame]
+		if f.Command&movie.CommandHardReset != 0 && frame > 0 {
+			n.stopMovie()
+			n.showMessage("MOVIE: POWER CYCLE NOT SUPPORTED")
+			return
+		}
+		if f.Command&movie.CommandSoftReset != 0 {
+			n.reset()
+		}
+		n.pads = f.Pads
+	case n.isMovieRecording:
+		n.movie.Truncate(frame)
+		n.movie.Frames = append(n.movie.Frames, movie.Frame{Pads: n.pads})
+	}
+}
+
+//powerOn はROMを読み直して電源を入れ直す．ムービーの決定性のため .sav は読まない．
+//元のコンソールは preMovie に取っておき，ムービーの SRAM で .sav を上書きしないようにする
+func (n *NES) powerOn() error {
+	n.flushSRAM()
+	cart, err := Load(n.romPath)
+	if err != nil {
+		return err
+	}
+	cart.MMC3RevA = n.console.Cartridge.MMC3RevA
+	if n.preMovie == nil {
+		n.preMovie = n.console
+	}
+	n.setConsole(console.New(cart))
+	return nil
+}
+
+//setConsole は動かすコンソールを c に差し替える．トレースはつなぎ替え，巻き戻しは取り直す
+func (n *NES) setConsole(c *console.Console) {
+	if n.isRecording {
+		n.console.CPU.SetTracer(nil)
+		c.CPU.SetTracer(n.tracer)
+	}
+	n.console = c
+	n.SetRewindMB(n.rewindMB)
+}
+
+//reset はリセットボタン．巻き戻しの記録はリセットの後から取り直す
+func (n *NES) reset() {
+	n.console.Reset()
+	if n.rewinder != nil {
+		n.rewinder.Cut()
+	}
+}
+
+//movieStatus は画面に出すムービーの状態
+func (n *NES) movieStatus() string {
+	switch {
+	case n.isMovieRecording:
+		return fmt.Sprintf("MOVIE REC %d", n.movieFrame())
+	case n.isMoviePlaying:
+		return fmt.Sprintf("MOVIE %d/%d", n.movieFrame(), len(n.movie.Frames))
+	}
+	return ""
+}
@@ -0,0 +1,236 @@
+//Package movie はフレームごとのコントローラ入力の記録 (FCEUX の FM2 形式)
+package movie
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pishiko/gones/cartridge"
+	"github.com/pishiko/gones/input"
+)
+
+//fm2Buttons は FM2 の入力欄の並び．添字は input.Button の逆順
+const fm2Buttons = "RLDUTSBA"
+
+//Command は各フレームの前に行う操作 (FM2 の commands 欄)
+type Command uint8
+
+const (
+	CommandSoftReset Command = 1 << iota
+	CommandHardReset
+)
+
+//Frame は1フレーム分の入力
+type Frame struct {
+	Command Command
+	Pads    [2]input.Buttons
+}
+
+//Movie は電源投入かセーブステートから始まる入力の記録
+type Movie struct {
+	RerecordCount int
+	ROMFilename   string
+	//ROMChecksum は FCEUX と同じ PRG/CHR-ROM の MD5 ("base64:..." の形)
+	ROMChecksum string
+	GUID        string
+	Comments    []string
+	//SaveState は記録を始めたときの状態 (console.SaveState の形式)．nil なら電源投入から
+	SaveState []byte
+	Frames    []Frame
+	//extra は知らないヘッダ．書き出すときにそのまま戻す
+	extra      [][2]string
+	hasVersion bool
+}
+
+//New は cart で電源投入から記録する空のムービーを作る
+func New(cart *cartridge.Cartridge, romFilename string) *Movie {
+	return &Movie{
+		ROMFilename: romFilename,
+		ROMChecksum: Checksum(cart),
+		GUID:        newGUID(cart),
+	}
+}
+
+//Checksum は FCEUX の romChecksum と同じくPRG/CHR-ROMのMD5を base64 にする
+func Checksum(cart *cartridge.Cartridge) string {
+	h := md5.New()
+	h.Write(cart.PRG)
+	if !cart.IsCHRRAM {
+		h.Write(cart.CHR)
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+//newGUID はムービーの識別子．乱数を使わずROMから作り，再生の決定性に影響しないようにする
+func newGUID(cart *cartridge.Cartridge) string {
+	sum := md5.Sum([]byte(Checksum(cart)))
+	return fmt.Sprintf("%X-%X-%X-%X-%X", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+//Truncate は frame 以降の記録を捨てる (撮り直し)
+func (m *Movie) Truncate(frame int) {
+	if frame < len(m.Frames) {
+		m.Frames = m.Frames[:frame]
+		m.RerecordCount++
+	}
+}
+
+//Read は FM2 のテキストを読む．バイナリ形式の入力ログには対応しない
+func Read(r io.Reader) (*Movie, error) {
+	m := &Movie{}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 64<<20)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimRight(s.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		if text[0] == '|' {
+			frame, err := parseFrame(text)
+			if err != nil {
+				return nil, fmt.Errorf("movie: line %d: %v", line, err)
+			}
+			m.Frames = append(m.Frames, frame)
+			continue
+		}
+		key, value := text, ""
+		if i := strings.IndexByte(text, ' '); i >= 0 {
+			key, value = text[:i], text[i+1:]
+		}
+		if err := m.setHeader(key, value); err != nil {
+			return nil, fmt.Errorf("movie: line %d: %v", line, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if !m.hasVersion {
+		return nil, fmt.Errorf("movie: not an FM2 file (no version line)")
+	}
+	return m, nil
+}
+
+func (m *Movie) setHeader(key, value string) error {
+	var err error
+	switch key {
+	case "version":
+		if value != "3" {
+			return fmt.Errorf("unsupported FM2 version %s", value)
+		}
+		m.hasVersion = true
+	case "binary":
+		if value != "0" {
+			return fmt.Errorf("binary input logs are not supported")
+		}
+	case "palFlag":
+		if value != "0" {
+			return fmt.Errorf("PAL movies are not supported")
+		}
+	case "fourscore":
+		if value != "0" {
+			return fmt.Errorf("four score movies are not supported")
+		}
+	case "port0", "port1":
+		//0:なし 1:標準コントローラ
+		if value != "0" && value != "1" {
+			return fmt.Errorf("%s: input device %s is not supported", key, value)
+		}
+	case "rerecordCount":
+		m.RerecordCount, err = strconv.Atoi(value)
+	case "romFilename":
+		m.ROMFilename = value
+	case "romChecksum":
+		m.ROMChecksum = value
+	case "guid":
+		m.GUID = value
+	case "comment":
+		m.Comments = append(m.Comments, value)
+	case "savestate":
+		m.SaveState, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(value, "base64:"))
+	case "emuVersion", "port2", "FDS", "NewPPU", "microphone", "length":
+		//書き出すときに作り直す
+	default:
+		m.extra = append(m.extra, [2]string{key, value})
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	return nil
+}
+
+//parseFrame は "|c|RLDUTSBA|RLDUTSBA||" の1行を読む．'.' と ' ' 以外の文字は押している
+func parseFrame(text string) (Frame, error) {
+	var f Frame
+	fields := strings.Split(text, "|")
+	if len(fields) < 4 {
+		return f, fmt.Errorf("malformed input line %q", text)
+	}
+	command, err := strconv.Atoi(fields[1])
+	if err != nil || command < 0 || command > 0xff {
+		return f, fmt.Errorf("bad command %q", fields[1])
+	}
+	f.Command = Command(command)
+	for p := 0; p < 2; p++ {
+		field := fields[2+p]
+		if field == "" {
+			continue
+		}
+		if len(field) != len(fm2Buttons) {
+			return f, fmt.Errorf("port %d: want %d buttons, got %q", p, len(fm2Buttons), field)
+		}
+		for i := 0; i < len(field); i++ {
+			if field[i] != '.' && field[i] != ' ' {
+				f.Pads[p][len(fm2Buttons)-1-i] = true
+			}
+		}
+	}
+	return f, nil
+}
+
+//Write は FM2 のテキストで書き出す
+func (m *Movie) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "version 3\n")
+	fmt.Fprintf(b, "emuVersion 0\n")
+	fmt.Fprintf(b, "rerecordCount %d\n", m.RerecordCount)
+	fmt.Fprintf(b, "palFlag 0\n")
+	fmt.Fprintf(b, "romFilename %s\n", m.ROMFilename)
+	fmt.Fprintf(b, "romChecksum %s\n", m.ROMChecksum)
+	fmt.Fprintf(b, "guid %s\n", m.GUID)
+	fmt.Fprintf(b, "fourscore 0\n")
+	fmt.Fprintf(b, "microphone 0\n")
+	fmt.Fprintf(b, "port0 1\n")
+	fmt.Fprintf(b, "port1 1\n")
+	fmt.Fprintf(b, "port2 0\n")
+	fmt.Fprintf(b, "FDS 0\n")
+	fmt.Fprintf(b, "NewPPU 0\n")
+	for _, kv := range m.extra {
+		fmt.Fprintf(b, "%s %s\n", kv[0], kv[1])
+	}
+	for _, c := range m.Comments {
+		fmt.Fprintf(b, "comment %s\n", c)
+	}
+	if m.SaveState != nil {
+		fmt.Fprintf(b, "savestate base64:%s\n", base64.StdEncoding.EncodeToString(m.SaveState))
+	}
+	for _, f := range m.Frames {
+		fmt.Fprintf(b, "|%d|%s|%s||\n", f.Command, formatPad(f.Pads[0]), formatPad(f.Pads[1]))
+	}
+	return b.Flush()
+}
+
+func formatPad(pad input.Buttons) string {
+	var s [len(fm2Buttons)]byte
+	for i := range s {
+		s[i] = '.'
+		if pad[len(fm2Buttons)-1-i] {
+			s[i] = fm2Buttons[i]
+		}
+	}
+	return string(s[:])
+}
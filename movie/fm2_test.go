@@ -0,0 +1,119 @@
+package movie
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pishiko/gones/input"
+)
+
+const sample = "version 3\r\n" +
+	"emuVersion 22020\n" +
+	"rerecordCount 7\n" +
+	"palFlag 0\n" +
+	"romFilename Test ROM\n" +
+	"romChecksum base64:AAECAwQFBgcICQoLDA0ODw==\n" +
+	"guid 01234567-89AB-CDEF-0123-456789ABCDEF\n" +
+	"fourscore 0\n" +
+	"port0 1\n" +
+	"port1 0\n" +
+	"comment author someone\n" +
+	"comment second line\n" +
+	"subtitle 10 hello\n" +
+	"savestate base64:R05TVA==\n" +
+	"|1|........|||\n" +
+	"|0|R......A|.L....B.||\n" +
+	"|0|.xDUTS..|||\n"
+
+func TestRead(t *testing.T) {
+	m, err := Read(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.RerecordCount != 7 || m.ROMFilename != "Test ROM" || m.ROMChecksum != "base64:AAECAwQFBgcICQoLDA0ODw==" ||
+		m.GUID != "01234567-89AB-CDEF-0123-456789ABCDEF" {
+		t.Errorf("header: %+v", m)
+	}
+	if !reflect.DeepEqual(m.Comments, []string{"author someone", "second line"}) {
+		t.Errorf("comments: %q", m.Comments)
+	}
+	if string(m.SaveState) != "GNST" {
+		t.Errorf("savestate: %q", m.SaveState)
+	}
+
+	var want [3]Frame
+	want[0].Command = CommandSoftReset
+	want[1].Pads[0][input.ButtonRight] = true
+	want[1].Pads[0][input.ButtonA] = true
+	want[1].Pads[1][input.ButtonLeft] = true
+	want[1].Pads[1][input.ButtonB] = true
+	for _, b := range []input.Button{input.ButtonLeft, input.ButtonDown, input.ButtonUp, input.ButtonStart, input.ButtonSelect} {
+		want[2].Pads[0][b] = true
+	}
+	if !reflect.DeepEqual(m.Frames, want[:]) {
+		t.Errorf("frames:\n got %v\nwant %v", m.Frames, want)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	m, err := Read(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := m.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "subtitle 10 hello\n") || !strings.Contains(out.String(), "|0|R......A|.L....B.||\n") {
+		t.Errorf("written movie:\n%s", out.String())
+	}
+	again, err := Read(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, m) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", again, m)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		movie string
+		err   string
+	}{
+		{"empty", "", "no version line"},
+		{"no version", "romFilename x\n|0|........|||\n", "no version line"},
+		{"version", "version 2\n", "unsupported FM2 version"},
+		{"binary", "version 3\nbinary 1\n", "binary input logs"},
+		{"PAL", "version 3\npalFlag 1\n", "PAL movies"},
+		{"four score", "version 3\nfourscore 1\n", "four score"},
+		{"zapper", "version 3\nport1 2\n", "port1: input device 2"},
+		{"rerecord count", "version 3\nrerecordCount many\n", "line 2: rerecordCount"},
+		{"savestate", "version 3\nsavestate base64:!!\n", "line 2: savestate"},
+		{"short frame", "version 3\n|0|\n", "line 2: malformed input line"},
+		{"command", "version 3\n|x|........|||\n", "bad command"},
+		{"command range", "version 3\n|256|........|||\n", "bad command"},
+		{"buttons", "version 3\n|0|.......|||\n", "port 0: want 8 buttons"},
+	}
+	for _, tt := range tests {
+		_, err := Read(strings.NewReader(tt.movie))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	m := &Movie{Frames: make([]Frame, 10)}
+	m.Truncate(10)
+	if len(m.Frames) != 10 || m.RerecordCount != 0 {
+		t.Errorf("truncate at end: %d frames, %d rerecords", len(m.Frames), m.RerecordCount)
+	}
+	m.Truncate(4)
+	if len(m.Frames) != 4 || m.RerecordCount != 1 {
+		t.Errorf("truncate: %d frames, %d rerecords", len(m.Frames), m.RerecordCount)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pishiko/gones/cartridge"
+	"github.com/pishiko/gones/console"
+)
+
+//writeBatteryROM は毎フレーム $6000 を書き換えるバッテリー付きNROMを dir に置く
+func writeBatteryROM(t *testing.T, dir string) string {
+	t.Helper()
+	header := []uint8{'N', 'E', 'S', 0x1a, 1, 1, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	prg := make([]uint8, 0x4000)
+	copy(prg, []uint8{
+		0xee, 0x00, 0x60, //loop: INC $6000
+		0x4c, 0x00, 0x80, //JMP loop
+	})
+	prg[0x3ffc], prg[0x3ffd] = 0x00, 0x80
+	path := filepath.Join(dir, "test.nes")
+	rom := append(append(header, prg...), make([]uint8, 0x2000)...)
+	if err := ioutil.WriteFile(path, rom, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+//newTestNES は画面と音を持たない NES を作る
+func newTestNES(t *testing.T, romPath string) *NES {
+	t.Helper()
+	cart, err := Load(romPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &NES{romPath: romPath, savePath: cartridge.SavePath(romPath)}
+	n.moviePath = filepath.Join(filepath.Dir(romPath), "test.fm2")
+	if err := cart.LoadSRAM(n.savePath); err != nil {
+		t.Fatal(err)
+	}
+	n.console = console.New(cart)
+	return n
+}
+
+//TestMovieKeepsSRAM は電源投入からのムービーを記録・再生しても .sav が変わらず，
+//止めた後は元のコンソールに戻って .sav への書き出しが続くか
+func TestMovieKeepsSRAM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	romPath := writeBatteryROM(t, dir)
+	sav := bytes.Repeat([]uint8{0x5a}, 0x2000)
+	savePath := cartridge.SavePath(romPath)
+	if err := ioutil.WriteFile(savePath, sav, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	n := newTestNES(t, romPath)
+	original := n.console
+	run := func(frames int) {
+		for i := 0; i < frames; i++ {
+			if n.isMovieRecording || n.isMoviePlaying {
+				n.sampleMovie()
+			}
+			n.stepFrame()
+		}
+	}
+	if err := n.startRecording(true); err != nil {
+		t.Fatal(err)
+	}
+	run(10)
+	n.stopMovie()
+	n.flushSRAM()
+	if err := n.startPlayback(n.moviePath); err != nil {
+		t.Fatal(err)
+	}
+	//最後まで再生すると次のフレームで止まる
+	run(10)
+	n.sampleMovie()
+	if n.isMoviePlaying {
+		t.Fatal("movie did not end")
+	}
+	n.flushSRAM()
+
+	got, err := ioutil.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, sav) {
+		t.Fatalf(".sav changed by movie: $6000 = $%02X", got[0])
+	}
+	if n.console != original {
+		t.Fatal("console was not restored after the movie")
+	}
+
+	n.stepFrame()
+	n.flushSRAM()
+	if got, _ := ioutil.ReadFile(savePath); bytes.Equal(got, sav) {
+		t.Fatal(".sav is not written after the movie")
+	}
+}
@@ -1,91 +1,228 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"io/ioutil"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/pishiko/gones/apu"
+	"github.com/pishiko/gones/cartridge"
+	"github.com/pishiko/gones/console"
 	"github.com/pishiko/gones/cpu"
-	"github.com/pishiko/gones/ppu"
+	"github.com/pishiko/gones/input"
+	"github.com/pishiko/gones/movie"
 )
 
 var (
-	//A,B,Select,Start,Up,Down,Left,Right
-	keymap = []ebiten.Key{
-		ebiten.KeyL,
-		ebiten.KeyK,
-		ebiten.KeyO,
-		ebiten.KeyP,
-		ebiten.KeyW,
-		ebiten.KeyS,
-		ebiten.KeyA,
-		ebiten.KeyD,
-	}
 	pauseBG *ebiten.Image
 	pauseOP *ebiten.DrawImageOptions
 )
 
+//traceLogPath R キーで記録するCPUトレースの出力先
+const traceLogPath = "neslog.log"
+
+//sramFlushFrames ごとにバッテリーバックアップを .sav に書き出す
+const sramFlushFrames = 60 * 5
+
+//messageFrames 画面にメッセージを出しておくフレーム数
+const messageFrames = 60 * 2
+
+//defaultVolume は音量の既定値 (0-1)
+const defaultVolume = 1.0
+
+//rewindKey を押している間は1フレームずつ巻き戻す
+const rewindKey = ebiten.KeyBackspace
+
+const (
+	//rewindInterval スナップショットを取る間隔(フレーム)
+	rewindInterval = 5
+	//defaultRewindMB 巻き戻し用に使うメモリの既定値(MB)
+	defaultRewindMB = 32
+)
+
+//movieKey でムービーの記録 (Shift で電源投入から)，movieKey と Control で再生
+const movieKey = ebiten.KeyF6
+
+//errInterrupted は Ctrl+C で止めたときに Update が返す
+var errInterrupted = errors.New("interrupted")
+
+//stateSlotKeys F1-F4 でスロット1-4にクイックセーブ，Shift を押しながらでロード
+var stateSlotKeys = []ebiten.Key{ebiten.KeyF1, ebiten.KeyF2, ebiten.KeyF3, ebiten.KeyF4}
+
 type NES struct {
-	cpu       *cpu.CPU
-	ppu       *ppu.PPU
-	apu       *apu.APU
-	canvas    *ebiten.Image
-	keys      [8]bool
-	gamepadID ebiten.GamepadID
+	console  *console.Console
+	canvas   *ebiten.Image
+	audio    *audioStream
+	player   *audio.Player
+	volume   float64
+	pads     [2]input.Buttons
+	bindings [2]binding
+	macros   []macroBinding
+	//gamepads はつながっているゲームパッド (つながった順)
+	gamepads  []ebiten.GamepadID
+	savePath  string
+	romPath   string
+	statePath string
+	moviePath string
+	frame     int
+	tracer    *cpu.Tracer
+	traceFile *os.File
+	interrupt chan os.Signal
+	rewinder  *console.Rewinder
+	rewindMB  int
+	//ムービー
+	movie            *movie.Movie
+	movieStart       int
+	isMovieRecording bool
+	isMoviePlaying   bool
+	//preMovie は電源を入れ直してムービーを始める前のコンソール
+	preMovie *console.Console
 	//interface
 	isDebug     bool
 	isPlay      bool
 	isRecording bool
+	isRewinding bool
+	message     string
+	messageLeft int
 }
 
-func Load(path string) ([]uint8, []uint8, []uint8) {
+//Load はROMファイルを読み込み，ヘッダを検証してカートリッジを返す
+func Load(path string) (*cartridge.Cartridge, error) {
 	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-
-	prgSize := int(bytes[4]) * 0x4000
-	chrSize := int(bytes[5]) * 0x2000
-	prgRom := make([]uint8, prgSize)
-	prgRom = bytes[16 : 16+prgSize]
-	var chrRom []uint8
-	if chrSize != 0 {
-		chrRom = make([]uint8, chrSize)
-		chrRom = bytes[16+prgSize : 16+prgSize+chrSize]
-	} else {
-		chrRom = make([]uint8, 0x2000)
+	cart, err := cartridge.Load(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
 	}
-
-	return bytes[:16], prgRom, chrRom
+	return cart, nil
 }
 
-func NewNES(path string) *NES {
+func NewNES(path string) (*NES, error) {
 	n := new(NES)
-	n.keys = [8]bool{}
-	header, prg, chr := Load(path)
-	isHorizontalMirror := header[6]&0x01 == 0x00
-	n.ppu = ppu.NewPPU(chr, isHorizontalMirror)
-	n.apu = apu.NewAPU(0)
-	n.cpu = cpu.NewCPU(prg, n.ppu, n.apu)
+	cart, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	n.romPath = path
+	n.savePath = cartridge.SavePath(path)
+	n.statePath = strings.TrimSuffix(path, filepath.Ext(path)) + ".state"
+	n.moviePath = strings.TrimSuffix(path, filepath.Ext(path)) + ".fm2"
+	if err := cart.LoadSRAM(n.savePath); err != nil {
+		return nil, err
+	}
+	n.console = console.New(cart)
+	configPath, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := n.LoadConfig(configPath); err != nil {
+		return nil, err
+	}
+	n.SetRewindMB(defaultRewindMB)
 	n.canvas = ebiten.NewImage(256, 240)
+	n.audio = &audioStream{}
+	n.player, err = audio.NewPlayer(audio.NewContext(apu.SampleRate), n.audio)
+	if err != nil {
+		return nil, err
+	}
+	n.SetVolume(defaultVolume)
+	n.player.Play()
 	n.isPlay = true
 	pauseBG = ebiten.NewImage(256, 240)
 	pauseBG.Fill(color.Black)
 	pauseOP = &ebiten.DrawImageOptions{}
 	pauseOP.ColorM.Scale(0, 0, 0, 0.5)
-	return n
+	return n, nil
 }
 
 func (n *NES) SetDebug() {
 	n.isDebug = true
 }
 
+//SetMMC3RevA はMMC3のIRQを旧仕様(Rev A)で動かす
+func (n *NES) SetMMC3RevA() {
+	n.console.Cartridge.MMC3RevA = true
+}
+
+//LoadConfig はキー・ゲームパッドの割り当てを path から読む
+func (n *NES) LoadConfig(path string) error {
+	config, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	bindings, err := config.bindings()
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	macros, err := config.macros()
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	n.bindings = bindings
+	n.macros = macros
+	return nil
+}
+
+//SetVolume は音量を v (0-1) にする
+func (n *NES) SetVolume(v float64) {
+	if v < 0 {
+		v = 0
+	} else if v > 1 {
+		v = 1
+	}
+	n.volume = v
+	n.player.SetVolume(v)
+}
+
+//SetRewindMB は巻き戻しに使うメモリを mb MB にする．0なら巻き戻さない
+func (n *NES) SetRewindMB(mb int) {
+	n.rewindMB = mb
+	if mb <= 0 {
+		n.rewinder = nil
+		return
+	}
+	n.rewinder = console.NewRewinder(n.console, rewindInterval, mb<<20)
+}
+
+//SetMoviePath はムービーの記録・再生に使うファイルを path にする
+func (n *NES) SetMoviePath(path string) {
+	n.moviePath = path
+}
+
+//PlayMovie は path のムービーを再生する
+func (n *NES) PlayMovie(path string) error {
+	n.moviePath = path
+	return n.startPlayback(path)
+}
+
+//RecordMovie は電源投入から path へムービーを記録する
+func (n *NES) RecordMovie(path string) error {
+	n.moviePath = path
+	return n.startRecording(true)
+}
+
+//SetStatePath は F9/F10 で保存・読み込みするステートのファイルを path にし，あれば読み込む
+func (n *NES) SetStatePath(path string) error {
+	n.statePath = path
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	return n.console.LoadStateFile(path)
+}
+
 //////////////////////
 //ebiten Callbacks
 
@@ -93,21 +230,31 @@ func (n *NES) SetDebug() {
 func (n *NES) Draw(screen *ebiten.Image) {
 
 	//Draw NES frame
-	background, sprites := n.ppu.Draw()
-	n.canvas.DrawImage(background, nil)
-	n.canvas.DrawImage(sprites, nil)
+	n.canvas.ReplacePixels(n.console.Frame().Pix)
 
 	//Draw interface
 	if !n.isPlay {
 		n.canvas.DrawImage(pauseBG, pauseOP)
 	} else {
 		if n.isDebug {
-			ebitenutil.DebugPrint(n.canvas, fmt.Sprintf("TPS:%0.2f, %s", ebiten.CurrentTPS(), n.cpu.GetDebugText()))
+			ebitenutil.DebugPrint(n.canvas, fmt.Sprintf("TPS:%0.2f, %s", ebiten.CurrentTPS(), n.console.CPU.GetDebugText()))
 		}
 	}
 	if n.isRecording {
 		ebitenutil.DebugPrintAt(n.canvas, "REC", 230, 0)
 	}
+	if n.isRewinding {
+		ebitenutil.DebugPrintAt(n.canvas, "<<", 0, 0)
+	}
+	if n.messageLeft > 0 {
+		ebitenutil.DebugPrintAt(n.canvas, n.message, 0, 208)
+	}
+	if status := n.movieStatus(); status != "" {
+		ebitenutil.DebugPrintAt(n.canvas, status, 0, 192)
+	}
+	if err := n.console.CPU.Jammed(); err != nil {
+		ebitenutil.DebugPrintAt(n.canvas, err.Error(), 0, 224)
+	}
 	//x3
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(3, 3)
@@ -120,29 +267,64 @@ func (n *NES) Layout(screenWidth, screenHeight int) (int, int) {
 }
 
 func (n *NES) Update() error {
+	select {
+	case <-n.interrupt:
+		return errInterrupted
+	default:
+	}
 	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
 		n.isPlay = !n.isPlay
 	}
 	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
 		if n.isRecording {
-			ioutil.WriteFile("neslog.log", ([]byte)(n.cpu.DebugLog), 0666)
-			n.cpu.DebugLog = ""
+			n.stopTrace()
+		} else if err := n.startTrace(traceLogPath); err != nil {
+			log.Println(err)
 		}
-		n.isRecording = !n.isRecording
-		n.cpu.IsRecord = n.isRecording
 		n.isPlay = false
 	}
+	for i, key := range stateSlotKeys {
+		if inpututil.IsKeyJustPressed(key) {
+			path := n.slotPath(i + 1)
+			if ebiten.IsKeyPressed(ebiten.KeyShift) {
+				n.loadState(path, fmt.Sprintf("LOAD SLOT %d", i+1))
+			} else {
+				n.saveState(path, fmt.Sprintf("SAVE SLOT %d", i+1))
+			}
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+		n.saveState(n.statePath, "SAVE "+filepath.Base(n.statePath))
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF10) {
+		n.loadState(n.statePath, "LOAD "+filepath.Base(n.statePath))
+	}
+	if inpututil.IsKeyJustPressed(movieKey) {
+		n.toggleMovie()
+	}
+	if n.messageLeft > 0 {
+		n.messageLeft--
+	}
+	n.updateGamepads()
 
-	if n.isPlay {
-		//NES Emulation
-		for k := 0; k < 8; k++ {
-			n.keys[k] = ebiten.IsKeyPressed(keymap[k])
+	n.isRewinding = false
+	if n.isPlay && n.rewinder != nil && ebiten.IsKeyPressed(rewindKey) {
+		ok, err := n.rewinder.Rewind()
+		if err != nil {
+			log.Println(err)
+		}
+		n.isRewinding = ok
+	} else if n.isPlay {
+		//NES Emulation．入力は1フレームに1回だけ読む
+		n.readPads()
+		if n.isMovieRecording || n.isMoviePlaying {
+			n.sampleMovie()
 		}
-		isScreenReady := false
-		for !isScreenReady {
-			cycle := n.cpu.Run(n.keys)
-			isScreenReady = n.ppu.Run(cycle * 3)
-			n.apu.Run(cycle)
+		n.stepFrame()
+		n.audio.Write(n.console.Samples())
+		n.frame++
+		if n.frame%sramFlushFrames == 0 {
+			n.flushSRAM()
 		}
 	} else {
 
@@ -158,11 +340,175 @@ func (n *NES) init() {
 
 func (n *NES) Run() {
 	n.init()
-	if err := ebiten.RunGame(n); err != nil {
+	//Ctrl+C で終了したときもセーブを失わないようにする．
+	//書き出しはエミュレーションと並行させず，Update に止めさせてから閉じたときと同じ道で行う
+	n.interrupt = make(chan os.Signal, 1)
+	signal.Notify(n.interrupt, os.Interrupt)
+
+	err := ebiten.RunGame(n)
+	n.stopTrace()
+	n.stopMovie()
+	n.flushSRAM()
+	if err == errInterrupted {
+		os.Exit(1)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+//startTrace は path へのCPUトレース(nestest形式)を始める
+func (n *NES) startTrace(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	n.traceFile = f
+	n.tracer = cpu.NewTracer(f)
+	n.console.CPU.SetTracer(n.tracer)
+	n.isRecording = true
+	return nil
+}
+
+//stopTrace はトレースを止めてファイルを閉じる
+func (n *NES) stopTrace() {
+	if !n.isRecording {
+		return
+	}
+	n.console.CPU.SetTracer(nil)
+	if err := n.tracer.Flush(); err != nil {
+		log.Println(err)
+	}
+	if err := n.traceFile.Close(); err != nil {
+		log.Println(err)
+	}
+	n.isRecording = false
+}
+
+//readPads はキー・ゲームパッド・マクロからこのフレームのボタンを決める．
+//連射の位相は次に作るフレームの番号に合わせる
+func (n *NES) readPads() {
+	frame := n.console.PPU.FrameCount
+	for p := range n.pads {
+		id, ok := n.gamepad(p)
+		n.pads[p] = n.bindings[p].read(id, ok, frame)
+	}
+	for _, m := range n.macros {
+		if inpututil.IsKeyJustPressed(m.key) {
+			m.macro.Trigger()
+		}
+		if buttons, ok := m.macro.Next(); ok {
+			n.pads[m.player] = n.pads[m.player].Or(buttons)
+		}
+	}
+}
+
+//toggleMovie はムービーの記録・再生を始めるか止める
+func (n *NES) toggleMovie() {
+	if n.isMovieRecording || n.isMoviePlaying {
+		n.stopMovie()
+		n.showMessage("MOVIE STOPPED")
+		return
+	}
+	var err error
+	switch {
+	case ebiten.IsKeyPressed(ebiten.KeyControl):
+		err = n.startPlayback(n.moviePath)
+	default:
+		err = n.startRecording(ebiten.IsKeyPressed(ebiten.KeyShift))
+	}
+	if err != nil {
+		log.Println(err)
+		n.showMessage("MOVIE FAILED")
+		return
+	}
+	n.showMessage("MOVIE " + filepath.Base(n.moviePath))
+}
+
+//updateGamepads はゲームパッドの抜き差しを反映する
+func (n *NES) updateGamepads() {
+	gamepads := n.gamepads[:0]
+	for _, id := range n.gamepads {
+		if inpututil.IsGamepadJustDisconnected(id) {
+			n.showMessage("GAMEPAD DISCONNECTED")
+			continue
+		}
+		gamepads = append(gamepads, id)
+	}
+	n.gamepads = gamepads
+	for _, id := range inpututil.JustConnectedGamepadIDs() {
+		n.gamepads = append(n.gamepads, id)
+		n.showMessage("GAMEPAD: " + ebiten.GamepadName(id))
+	}
+}
+
+//gamepad はプレイヤー player に割り当てたゲームパッド
+func (n *NES) gamepad(player int) (ebiten.GamepadID, bool) {
+	index := n.bindings[player].gamepadIndex
+	if index < 0 || index >= len(n.gamepads) {
+		return 0, false
+	}
+	return n.gamepads[index], true
+}
+
+//stepFrame は1画面分進める．巻き戻しが有効なら記録しながら進める
+func (n *NES) stepFrame() {
+	if n.rewinder == nil {
+		n.console.StepFrame(n.pads)
+		return
+	}
+	if err := n.rewinder.StepFrame(n.pads); err != nil {
+		log.Println(err)
+	}
+}
+
+//slotPath はクイックセーブのスロットのファイル (ROMと同じ場所の .ss1 など)
+func (n *NES) slotPath(slot int) string {
+	return fmt.Sprintf("%s.ss%d", strings.TrimSuffix(n.romPath, filepath.Ext(n.romPath)), slot)
+}
+
+func (n *NES) saveState(path, done string) {
+	if err := n.console.SaveStateFile(path); err != nil {
+		log.Println(err)
+		n.showMessage("SAVE FAILED")
+		return
+	}
+	n.showMessage(done)
+}
+
+func (n *NES) loadState(path, done string) {
+	//別の流れの状態に飛ぶのでムービーは止め，元のコンソールに読む
+	if n.isMovieRecording || n.isMoviePlaying {
+		n.stopMovie()
+	}
+	if err := n.console.LoadStateFile(path); err != nil {
+		log.Println(err)
+		n.showMessage("LOAD FAILED")
+		return
+	}
+	if n.rewinder != nil {
+		n.rewinder.Cut()
+	}
+	n.showMessage(done)
+}
+
+//showMessage は画面下にしばらく文字を出す
+func (n *NES) showMessage(text string) {
+	n.message = text
+	n.messageLeft = messageFrames
+}
+
+//flushSRAM はバッテリーバックアップを .sav に書き出す
+func (n *NES) flushSRAM() {
+	//ムービー中の SRAM は .sav から始めていないことがあるので書き出さない
+	if n.isMovieRecording || n.isMoviePlaying {
+		return
+	}
+	if err := n.console.Cartridge.SaveSRAM(n.savePath); err != nil {
+		log.Println(err)
+	}
+}
+
 func (n *NES) DrawPatternTable(sprites [][]uint8) *ebiten.Image {
 	canvas := ebiten.NewImage(256, 240)
 	canvas.Fill(color.Black)
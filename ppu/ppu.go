@@ -1,15 +1,9 @@
 package ppu
 
-//TODO
-//CtrlReg1 5
-//CtrlReg2 2,1,0
-
 import (
-	"fmt"
 	"image"
-	"image/color"
 
-	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/pishiko/gones/cartridge"
 )
 
 var (
@@ -31,346 +25,198 @@ var (
 		{0xFF, 0xF7, 0x9C}, {0xD7, 0xE8, 0x95}, {0xA6, 0xED, 0xAF}, {0xA2, 0xF2, 0xDA},
 		{0x99, 0xFF, 0xFC}, {0xDD, 0xDD, 0xDD}, {0x11, 0x11, 0x11}, {0x11, 0x11, 0x11},
 	}
-	bgColor = [4]color.Color{
-		color.RGBA{0xff, 0x00, 0xff, 0xff}, color.RGBA{0x00, 0xff, 0x00, 0xff},
-		color.RGBA{0x00, 0x00, 0xff, 0xff}, color.RGBA{0xff, 0x00, 0x00, 0xff},
-	}
+)
+
+const (
+	//ScreenWidth 画面の幅
+	ScreenWidth = 256
+	//ScreenHeight 画面の高さ
+	ScreenHeight = 240
 )
 
 type PPU struct {
 	////////////////////////////////////////////////////////////////
 	//Reg,RAM
 
-	ioRegister     [0x08]uint8
-	chrRom         []uint8
+	mapper         cartridge.Mapper
 	OAMAddr        uint8
 	OAM            [0x0100]uint8
-	isPPUAddrUp    bool
-	PPUAddr        uint16
-	vRAM           [0x4000]uint8
+	nameTable      [0x1000]uint8
+	palette        [0x20]uint8
 	statusRegister uint8
 	ctrlReg1       uint8
 	ctrlReg2       uint8
 	ppuBuffer      uint8
+	//openBus は最後にレジスタへ書かれた値．書き込み専用レジスタの読み出しで見える
+	openBus uint8
+
+	//loopy レジスタ
+	//v,t: yyy NN YYYYY XXXXX (fine Y, nametable, coarse Y, coarse X)
+	v uint16
+	t uint16
+	x uint8
+	w bool
+
+	//BG パイプライン
+	nextTile       uint8
+	nextAttribute  uint8
+	nextPatternLow uint8
+	nextPatternHi  uint8
+	patternShiftLo uint16
+	patternShiftHi uint16
+	attrShiftLo    uint16
+	attrShiftHi    uint16
 
 	////////////////////////////////////////////////////////////////
 	//other
 
-	tiles            [][4]*ebiten.Image
-	background       *ebiten.Image
-	sprites          *ebiten.Image
-	cycle            int
-	line             int
-	IsNMIOccured     bool
-	scrollX          uint8
-	scrollY          uint8
-	isScrollCounterY bool
-	isUpdateVRAM     bool
-	//0->true
-	isHorizontalMirror bool
-	backgroundPallet   [4 * 0x0400]uint8
+	//スプライト．257-320 でセカンダリOAMの8個分を読み出し，次のラインで使う
+	spriteCount     int
+	spriteIndex     [8]uint8
+	spriteX         [8]uint8
+	spriteAttr      [8]uint8
+	spritePatternLo [8]uint8
+	spritePatternHi [8]uint8
+	secondaryOAM    [8 * 4]uint8
+
+	//描画中のフレームのパレット番号
+	buffer [ScreenWidth * ScreenHeight]uint8
+	//Screen は最後に完成したフレームのパレット番号(0x00-0x3F)
+	Screen [ScreenWidth * ScreenHeight]uint8
+	frame  *image.RGBA
+
+	cycle      int
+	line       int
+	isOddFrame bool
+	//isVBlankSuppressed は vblank が立つ直前に $2002 を読んだとき，そのフレームの vblank を立てない
+	isVBlankSuppressed bool
+	//FrameCount は電源投入から vblank に入った回数
+	FrameCount int
 }
 
-func NewPPU(chr []uint8, isHorizontalMirror bool) *PPU {
+func NewPPU(mapper cartridge.Mapper) *PPU {
 	p := &PPU{}
-	p.chrRom = chr
+	p.mapper = mapper
 	p.OAM = [0x0100]uint8{0}
-	p.isPPUAddrUp = true
-	p.vRAM = [0x4000]uint8{0}
-	p.background = ebiten.NewImage(256, 240)
-	p.sprites = ebiten.NewImage(256, 240)
-	p.ctrlReg1 = 0x40
-	p.isHorizontalMirror = isHorizontalMirror
-	p.InitTiles()
-
-	//fmt.Printf("[Init PPU] Character Size:0x%x\n", len(chr))
+	p.frame = image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight))
 	return p
 }
 
-//Run は1画面が描画完了したらtrueを返す．
-func (p *PPU) Run(cycle int) bool {
-	p.cycle += cycle
-	if p.cycle > 341 {
-		p.cycle -= 341
-		p.line++
-		if p.line < 240 {
-			if p.line == 0 {
-				p.updateBGPallete()
-				if p.isUpdateVRAM {
-					p.isUpdateVRAM = false
-					p.InitTiles()
-				}
-			}
-			if p.line%8 == 0 {
-				p.drawBGLine()
-			}
-			p.drawSpLine()
-		} else if p.line == 241 {
-			//vblank set
-			p.statusRegister = (p.statusRegister & 0x7f) + 0x80
-			if p.ctrlReg1&0x80 != 0x00 {
-				p.IsNMIOccured = true
-			}
-			return true
-		} else if p.line == 262 {
-			p.IsNMIOccured = false
-			//0spritehit and vblank clear
-			p.statusRegister = p.statusRegister & 0x3f
-			p.resetBG()
-			p.sprites.Clear()
-			p.line = -1
-		}
-	}
-	return false
+//Position は次に処理するスキャンライン(0-261)とドット(0-340)
+func (p *PPU) Position() (line, dot int) {
+	return p.line, p.cycle
 }
 
-func (p *PPU) updateBGPallete() {
-	for i := 0; i < 4; i++ {
-		head := 0x23c0 + i*0x400
-		for py := 0; py < 8; py++ {
-			for px := 0; px < 8; px++ {
-				for block := 0; block < 4; block++ {
-					color := (p.vRAM[head+py*8+px] >> (block * 2)) & 0x03
-					blocky := block / 2
-					blockx := block % 2
-					index := py*16*8 + px*4 + blocky*32*2 + blockx*2
-					p.backgroundPallet[i*0x400+index] = color
-					p.backgroundPallet[i*0x400+index+1] = color
-					p.backgroundPallet[i*0x400+index+32] = color
-					p.backgroundPallet[i*0x400+index+32+1] = color
-				}
-			}
-		}
-	}
-	return
+//NMILine はPPUのNMI出力．vblank 中かつ $2000 bit7 が立っている間 true
+func (p *PPU) NMILine() bool {
+	return p.statusRegister&0x80 != 0x00 && p.ctrlReg1&0x80 != 0x00
 }
 
-func (p *PPU) resetBG() {
-	cindex := 0
-	switch p.ctrlReg2 >> 5 {
-	case 0x00:
-		cindex = 0
-	case 0x01:
-		cindex = 1
-	case 0x02:
-		cindex = 2
-	case 0x04:
-		cindex = 3
+//Run は cycle ドット進め，その間に vblank に入ったら(1画面が描画完了したら)trueを返す．
+func (p *PPU) Run(cycle int) bool {
+	isScreenReady := false
+	for i := 0; i < cycle; i++ {
+		if p.step() {
+			isScreenReady = true
+		}
 	}
-	p.background.Fill(bgColor[cindex])
+	return isScreenReady
 }
 
-func (p *PPU) Draw() (bg *ebiten.Image, sprites *ebiten.Image) {
-	if p.ctrlReg2&0x10 == 0x00 {
-		p.sprites.Clear()
-	}
-	if p.ctrlReg2&0x08 == 0x00 {
-		p.resetBG()
+//Frame は最後に完成したフレームをRGBAで返す
+func (p *PPU) Frame() *image.RGBA {
+	for i, c := range p.Screen {
+		rgb := nesColor[c]
+		p.frame.Pix[i*4+0] = rgb[0]
+		p.frame.Pix[i*4+1] = rgb[1]
+		p.frame.Pix[i*4+2] = rgb[2]
+		p.frame.Pix[i*4+3] = 0xff
 	}
-	return p.background, p.sprites
+	return p.frame
 }
 
-func (p *PPU) drawBGLine() {
-	tiley := p.line / 8
-
-	tableNum := int(p.ctrlReg1 & 0x03)
-
-	//Read Name Table
-	var head int
-	if int(p.scrollY)+p.line > 240 {
-		//+0x800
-		if tableNum/2 == 0 {
-			head = tableNum*0x400 + 0x20*((p.line+int(p.scrollY)-240)/8) + 0x800
-		} else {
-			head = tableNum*0x400 + 0x20*((p.line+int(p.scrollY)-240)/8) - 0x800
-		}
-	} else {
-		head = tableNum*0x400 + 0x20*((p.line+int(p.scrollY))/8)
-	}
-	xntOffset := int(p.scrollX / 8)
-
-	nameTable := make([]uint8, 0, 32)
-	nameTable = append(nameTable, p.vRAM[0x2000+head+xntOffset:0x2000+head+0x20]...)
-	palletTable := make([]uint8, 0, 32)
-	palletTable = append(palletTable, p.backgroundPallet[head+xntOffset:head+0x20]...)
-
-	if tableNum%2 == 0 {
-		nameTable = append(nameTable, p.vRAM[0x2000+head+0x400:0x2000+head+0x400+xntOffset]...)
-		palletTable = append(palletTable, p.backgroundPallet[head+0x400:head+0x400+xntOffset]...)
-	} else {
-		nameTable = append(nameTable, p.vRAM[0x2000+head-0x400:0x2000+head-0x400+xntOffset]...)
-		palletTable = append(palletTable, p.backgroundPallet[head-0x400:head-0x400+xntOffset]...)
-	}
-
-	//Read Pattern Table
-	var bgPatternOffset int
-	if p.ctrlReg1&0x10 != 0x00 {
-		bgPatternOffset = 0x100
-	} else {
-		bgPatternOffset = 0x00
-	}
-
-	//BACKGROUND
-	for tilex := 0; tilex < 0x20; tilex++ {
-		pHead := 0x3f00 + int(palletTable[tilex])*4
+func (p *PPU) isRendering() bool {
+	return p.ctrlReg2&0x18 != 0x00
+}
 
-		//0
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Translate(float64(tilex*8-int(p.scrollX%8)), float64(tiley*8-int(p.scrollY%8)))
-		c := nesColor[p.vRAM[0x3f00]]
-		op.ColorM.Scale(float64(c[0]), float64(c[1]), float64(c[2]), 1)
-		p.background.DrawImage(p.tiles[int(nameTable[tilex])+bgPatternOffset][0], op)
-		//1-3
-		for i := 1; i < 4; i++ {
-			op := &ebiten.DrawImageOptions{}
-			op.GeoM.Translate(float64(tilex*8-int(p.scrollX%8)), float64(tiley*8-int(p.scrollY%8)))
-			c := nesColor[p.vRAM[pHead+i]]
-			op.ColorM.Scale(float64(c[0]), float64(c[1]), float64(c[2]), 1)
-			p.background.DrawImage(p.tiles[int(nameTable[tilex])+bgPatternOffset][i], op)
-		}
+//nameTableIndex はミラーリングを解決してnameTable内の位置を返す
+func (p *PPU) nameTableIndex(addr uint16) uint16 {
+	addr = (addr - 0x2000) % 0x1000
+	table := addr / 0x400
+	switch p.mapper.Mirroring() {
+	case cartridge.MirrorHorizontal:
+		table = table / 2
+	case cartridge.MirrorVertical:
+		table = table % 2
+	case cartridge.MirrorSingleLower:
+		table = 0
+	case cartridge.MirrorSingleUpper:
+		table = 1
 	}
-	return
+	return table*0x400 + addr%0x400
 }
 
-func (p *PPU) drawSpLine() {
-	//SPRITES
-	var spPatternOffset int
-	if p.ctrlReg1&0x08 != 0x00 {
-		spPatternOffset = 0x100
-	} else {
-		spPatternOffset = 0x00
+func paletteIndex(addr uint16) uint16 {
+	index := addr % 0x20
+	//$3F10/$3F14/$3F18/$3F1C は $3F00/$3F04/$3F08/$3F0C のミラー
+	if index >= 0x10 && index%4 == 0 {
+		index -= 0x10
 	}
-	spCounter := 0
-	for i := 0; i < 64; i++ {
-		y := int(p.OAM[i*4])
-		tile := p.OAM[i*4+1]
-		attr := p.OAM[i*4+2]
-		x := p.OAM[i*4+3]
-		if p.line == y {
-			spCounter++
-			if spCounter == 9 {
-				p.statusRegister = (p.statusRegister & 0xdf) + 0x20
-				break
-			}
-
-			//0 Bomb
-			if i == 0 {
-				p.statusRegister = 0x40 + (p.statusRegister & 0xbf)
-			}
+	return index
+}
 
-			pHead := 0x3f10 + int(attr&0x03)*4
-			//01-11
-			for j := 1; j < 4; j++ {
-				c := nesColor[p.vRAM[pHead+j]]
-				op := &ebiten.DrawImageOptions{}
-				if attr&0x80 != 0x00 {
-					op.GeoM.Scale(1, -1)
-					op.GeoM.Translate(0, 8)
-				}
-				if attr&0x40 != 0x00 {
-					op.GeoM.Scale(-1, 1)
-					op.GeoM.Translate(8, 0)
-				}
-				op.GeoM.Translate(float64(x), float64(y+1))
-				op.ColorM.Scale(float64(c[0]), float64(c[1]), float64(c[2]), 1)
-				p.sprites.DrawImage(p.tiles[int(tile)+spPatternOffset][j], op)
-			}
-		}
-	}
-	if spCounter <= 8 {
-		p.statusRegister &= 0xdf
+func (p *PPU) readVRAM(addr uint16) uint8 {
+	addr %= 0x4000
+	switch {
+	//pattern Table 0,1
+	case addr < 0x2000:
+		return p.mapper.ReadPPU(addr)
+	//Name table 0-3 + mirror
+	case addr < 0x3f00:
+		return p.nameTable[p.nameTableIndex(addr)]
+	default:
+		return p.palette[paletteIndex(addr)]
 	}
-	return
 }
 
 func (p *PPU) writeVRAM(addr uint16, data uint8) {
+	addr %= 0x4000
 	switch {
 	//pattern Table 0,1
 	case addr < 0x2000:
-		p.isUpdateVRAM = true
-		p.chrRom[addr] = data
-
-	//Table 0
-	case addr < 0x2400:
-		p.vRAM[addr] = data
-		p.vRAM[addr+0x1000] = data
-		if p.isHorizontalMirror {
-			p.vRAM[addr+0x0400] = data
-			p.vRAM[addr+0x1400] = data
-		} else {
-			p.vRAM[addr+0x0800] = data
-			p.vRAM[addr+0x1800] = data
-		}
-
-	//Table 1
-	case addr < 0x2800:
-		p.vRAM[addr] = data
-		p.vRAM[addr+0x1000] = data
-		if p.isHorizontalMirror {
-			p.vRAM[addr-0x0400] = data
-			p.vRAM[addr-0x0400+0x1000] = data
-		} else {
-			p.vRAM[addr+0x0800] = data
-			if addr+0x1800 < 0x3f00 {
-				p.vRAM[addr+0x1800] = data //yabai
-			}
-		}
-
-	//Table 2
-	case addr < 0x2c00:
-		p.vRAM[addr] = data
-		p.vRAM[addr+0x1000] = data
-		if p.isHorizontalMirror {
-			p.vRAM[addr+0x0400] = data
-			if addr+0x1400 < 0x3f00 {
-				p.vRAM[addr+0x1400] = data //yabai
-			}
-		} else {
-			p.vRAM[addr-0x800] = data
-			p.vRAM[addr-0x800+0x1000] = data
-		}
-
-	//Table 3
-	case addr < 0x3000:
-		p.vRAM[addr] = data
-		if addr+0x1000 < 0x3f00 {
-			p.vRAM[addr+0x1000] = data //yabai
-		}
-		if p.isHorizontalMirror {
-			p.vRAM[addr-0x0400] = data
-			p.vRAM[addr-0x0400+0x1000] = data
-		} else {
-			p.vRAM[addr-0x800] = data
-			p.vRAM[addr-0x800+0x1000] = data
-		}
-	//Name table mirror
+		p.mapper.WritePPU(addr, data)
+	//Name table 0-3 + mirror
 	case addr < 0x3f00:
-		p.writeVRAM(addr-0x1000, data)
-
-	case addr < 0x3f20:
-		var i uint16
-		p.vRAM[addr] = data
-
-		switch addr {
-		case 0x3f10:
-			p.vRAM[0x3f00] = data
-		}
-		for i = 0; i < 7; i++ {
-			p.vRAM[addr+0x20+i*0x10] = data
-		}
-	case addr < 0x4000:
-		p.writeVRAM(0x3f00+(addr%0x10), data)
+		p.nameTable[p.nameTableIndex(addr)] = data
 	default:
-		//CANT REACH HERE!
-		fmt.Printf("[vRAM Write %X], ", addr)
+		//パレットRAMは6bit
+		p.palette[paletteIndex(addr)] = data & 0x3f
 	}
 	return
 }
 
+func (p *PPU) incrementAddr() {
+	//描画中の $2007 アクセスは coarse X と Y が同時に進む
+	if p.isRendering() && (p.line < 240 || p.line == 261) {
+		p.incrementX()
+		p.incrementY()
+		return
+	}
+	if p.ctrlReg1&0x04 != 0x00 {
+		p.v += 32
+	} else {
+		p.v++
+	}
+	p.v &= 0x7fff
+}
+
 func (p *PPU) WriteRegister(addr uint16, data uint8) {
+	p.openBus = data
 	switch addr {
 	case 0x2000:
+		//vblank 中に NMI を有効にすると NMILine が立ち，その場で NMI が起きる
 		p.ctrlReg1 = data
+		p.t = (p.t & 0xf3ff) | (uint16(data&0x03) << 10)
 	case 0x2001:
 		p.ctrlReg2 = data
 	case 0x2003:
@@ -379,31 +225,25 @@ func (p *PPU) WriteRegister(addr uint16, data uint8) {
 		p.OAM[p.OAMAddr] = data
 		p.OAMAddr++
 	case 0x2005:
-		if !p.isScrollCounterY {
-			p.scrollX = data
-			p.isScrollCounterY = true
+		if !p.w {
+			p.t = (p.t & 0xffe0) | uint16(data>>3)
+			p.x = data & 0x07
 		} else {
-			if data < 240 {
-				p.scrollY = data
-			} else {
-				//p.scrollY = 0
-			}
+			p.t = (p.t & 0x8fff) | (uint16(data&0x07) << 12)
+			p.t = (p.t & 0xfc1f) | (uint16(data&0xf8) << 2)
 		}
+		p.w = !p.w
 	case 0x2006:
-		if p.isPPUAddrUp {
-			p.PPUAddr = uint16(data) << 8
+		if !p.w {
+			p.t = (p.t & 0x80ff) | (uint16(data&0x3f) << 8)
 		} else {
-			p.PPUAddr += uint16(data)
+			p.t = (p.t & 0xff00) | uint16(data)
+			p.v = p.t
 		}
-		p.isPPUAddrUp = !p.isPPUAddrUp
+		p.w = !p.w
 	case 0x2007:
-		p.writeVRAM(p.PPUAddr, data)
-
-		if p.ctrlReg1&0x04 != 0x00 {
-			p.PPUAddr += 32
-		} else {
-			p.PPUAddr++
-		}
+		p.writeVRAM(p.v, data)
+		p.incrementAddr()
 	default:
 		//CANT REACH HERE!
 	}
@@ -412,63 +252,27 @@ func (p *PPU) WriteRegister(addr uint16, data uint8) {
 func (p *PPU) ReadRegister(addr uint16) uint8 {
 	switch addr {
 	case 0x2002:
-		ret := p.statusRegister
+		if p.line == 241 && p.cycle == 1 {
+			p.isVBlankSuppressed = true
+		}
+		ret := (p.statusRegister & 0xe0) | (p.openBus & 0x1f)
 		p.statusRegister &= 0x7f
-		p.isScrollCounterY = false
+		p.w = false
 		return ret
+	case 0x2004:
+		return p.OAM[p.OAMAddr]
 	case 0x2007:
 		var ret uint8
-		if p.PPUAddr < 0x2000 {
-			ret = p.ppuBuffer
-			p.ppuBuffer = p.chrRom[p.PPUAddr]
-		} else if p.PPUAddr < 0x3f00 {
+		if p.v%0x4000 < 0x3f00 {
 			ret = p.ppuBuffer
-			p.ppuBuffer = p.vRAM[p.PPUAddr]
+			p.ppuBuffer = p.readVRAM(p.v)
 		} else {
-			ret = p.vRAM[p.PPUAddr]
-		}
-		if p.ctrlReg1&0x04 != 0x00 {
-			p.PPUAddr += 32
-		} else {
-			p.PPUAddr++
+			//パレットは即座に返り，バッファには下のネームテーブルが入る
+			ret = p.readVRAM(p.v)
+			p.ppuBuffer = p.readVRAM(p.v - 0x1000)
 		}
+		p.incrementAddr()
 		return ret
 	}
-	return 0x00
-}
-
-func (p *PPU) InitTiles() {
-	tileSize := len(p.chrRom) / 16
-	t := make([][4]*ebiten.Image, tileSize)
-
-	//tile
-	for i := 0; i < tileSize; i++ {
-		out := [4][]uint8{}
-		for j := 0; j < 4; j++ {
-			out[j] = make([]uint8, 64*4)
-		}
-		// line
-		for y := 0; y < 8; y++ {
-			line0 := p.chrRom[i*16+y]
-			line1 := p.chrRom[i*16+8+y]
-			//dot
-			for x := 0; x < 8; x++ {
-				// px -> pallet index of 0-3
-				px := (((line0 >> (7 - x)) & 0x01) + (((line1 >> (7 - x)) & 0x01) << 1))
-				out[px][y*8*4+x*4+0] = 1
-				out[px][y*8*4+x*4+1] = 1
-				out[px][y*8*4+x*4+2] = 1
-				out[px][y*8*4+x*4+3] = 0xff
-			}
-		}
-		for j := 0; j < 4; j++ {
-			t[i][j] = ebiten.NewImageFromImage(&image.RGBA{
-				Pix:    out[j],
-				Stride: 8 * 4,
-				Rect:   image.Rect(0, 0, 8, 8),
-			})
-		}
-	}
-	p.tiles = t
-	return
+	return p.openBus
 }
@@ -0,0 +1,44 @@
+package ppu
+
+import (
+	"testing"
+
+	"github.com/pishiko/gones/cartridge"
+)
+
+func newTestPPU(t *testing.T) *PPU {
+	t.Helper()
+	header := []uint8{'N', 'E', 'S', 0x1a, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom := append(append(header, make([]uint8, 0x4000)...), make([]uint8, 0x2000)...)
+	cart, err := cartridge.Load(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPPU(cart)
+}
+
+//TestPaletteIs6Bit は描画オフのまま $3F00 に $FF を書いて1フレーム回しても色が範囲内に収まるか
+func TestPaletteIs6Bit(t *testing.T) {
+	for _, v := range []uint8{0x3f, 0x20} {
+		p := newTestPPU(t)
+		p.WriteRegister(0x2006, 0x3f)
+		p.WriteRegister(0x2006, 0x00)
+		p.WriteRegister(0x2007, 0xff)
+		p.WriteRegister(0x2006, v)
+		p.WriteRegister(0x2006, 0x00)
+		p.Run(341 * 262)
+
+		if got := p.readVRAM(0x3f00); got != 0x3f {
+			t.Errorf("v=$%02X00: palette $3F00 = $%02X, want $3F", v, got)
+		}
+		for i, c := range p.Screen {
+			if c > 0x3f {
+				t.Fatalf("v=$%02X00: pixel %d has color $%02X", v, i, c)
+			}
+		}
+		p.Frame()
+		if err := p.LoadState(p.SaveState()); err != nil {
+			t.Errorf("v=$%02X00: %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package ppu
+
+//step は1ドット分処理して次のドットへ進む．vblank に入ったらtrueを返す
+func (p *PPU) step() bool {
+	isVisibleLine := p.line < 240
+	isPreLine := p.line == 261
+	isVBlankStart := false
+
+	if p.isRendering() && (isVisibleLine || isPreLine) {
+		p.renderBG()
+		p.renderSprites()
+		if isVisibleLine && p.cycle >= 1 && p.cycle <= 256 {
+			p.renderPixel(p.cycle - 1)
+		}
+	} else if isVisibleLine && p.cycle >= 1 && p.cycle <= 256 {
+		p.buffer[p.line*ScreenWidth+p.cycle-1] = p.backdrop()
+	}
+
+	switch {
+	case p.line == 241 && p.cycle == 1:
+		//vblank set
+		p.Screen = p.buffer
+		p.FrameCount++
+		if !p.isVBlankSuppressed {
+			p.statusRegister |= 0x80
+		}
+		p.isVBlankSuppressed = false
+		isVBlankStart = true
+	case isPreLine && p.cycle == 1:
+		//0spritehit, overflow and vblank clear
+		p.statusRegister &= 0x1f
+	}
+
+	p.tick()
+	return isVBlankStart
+}
+
+//tick はドット/ラインを進める．奇数フレームは描画中ならプリレンダーラインの最終ドットを飛ばす
+func (p *PPU) tick() {
+	if p.line == 261 && p.cycle == 339 && p.isOddFrame && p.isRendering() {
+		p.cycle = 340
+	}
+	p.cycle++
+	if p.cycle > 340 {
+		p.cycle = 0
+		p.line++
+		if p.line > 261 {
+			p.line = 0
+			p.isOddFrame = !p.isOddFrame
+		}
+	}
+}
+
+//backdrop は描画オフ時の色．v がパレットを指していればその色が出る
+func (p *PPU) backdrop() uint8 {
+	if !p.isRendering() && p.v&0x3f00 == 0x3f00 {
+		return p.palette[paletteIndex(p.v)]
+	}
+	return p.palette[0x00]
+}
+
+//renderPixel は x 座標のBGとスプライトを優先順位に従って合成する
+func (p *PPU) renderPixel(x int) {
+	bgPx, bgColor := p.bgPixel(x)
+	spPx, spColor, spIndex, isFront := p.spritePixel(x)
+
+	c := bgColor
+	if spPx != 0 {
+		//スプライト0ヒットは両方が不透明な画素で起きる (x=255 を除く)
+		if spIndex == 0 && bgPx != 0 && x != 255 {
+			p.statusRegister |= 0x40
+		}
+		if bgPx == 0 || isFront {
+			c = spColor
+		}
+	}
+	if p.ctrlReg2&0x01 != 0x00 {
+		//grayscale
+		c &= 0x30
+	}
+	p.buffer[p.line*ScreenWidth+x] = c & 0x3f
+}
+
+//renderBG はBGのフェッチとシフトレジスタを1ドット分進める
+func (p *PPU) renderBG() {
+	isFetchCycle := (p.cycle >= 1 && p.cycle <= 256) || (p.cycle >= 321 && p.cycle <= 336)
+	isShiftCycle := (p.cycle >= 2 && p.cycle <= 257) || (p.cycle >= 322 && p.cycle <= 337)
+
+	if isShiftCycle {
+		p.shiftBG()
+		if (p.cycle-1)%8 == 0 {
+			p.reloadBG()
+		}
+	}
+	if isFetchCycle {
+		switch (p.cycle - 1) % 8 {
+		case 0:
+			p.nextTile = p.readVRAM(0x2000 | (p.v & 0x0fff))
+		case 2:
+			p.fetchAttribute()
+		case 4:
+			p.nextPatternLow = p.readVRAM(p.bgPatternAddr())
+		case 6:
+			p.nextPatternHi = p.readVRAM(p.bgPatternAddr() + 8)
+		case 7:
+			p.incrementX()
+		}
+	}
+	//次ラインの先頭に向けたダミーのネームテーブル読み出し
+	if p.cycle == 337 || p.cycle == 339 {
+		p.readVRAM(0x2000 | (p.v & 0x0fff))
+	}
+	if p.cycle == 256 {
+		p.incrementY()
+	}
+	if p.cycle == 257 {
+		p.copyX()
+	}
+	if p.line == 261 && p.cycle >= 280 && p.cycle <= 304 {
+		p.copyY()
+	}
+}
+
+//bgPixel はシフトレジスタから x 座標のパレット内番号と色を取り出す
+func (p *PPU) bgPixel(x int) (uint8, uint8) {
+	if p.ctrlReg2&0x08 == 0x00 || (x < 8 && p.ctrlReg2&0x02 == 0x00) {
+		return 0, p.palette[0x00]
+	}
+	mux := uint16(0x8000) >> p.x
+	var px, pal uint8
+	if p.patternShiftLo&mux != 0 {
+		px |= 0x01
+	}
+	if p.patternShiftHi&mux != 0 {
+		px |= 0x02
+	}
+	if p.attrShiftLo&mux != 0 {
+		pal |= 0x01
+	}
+	if p.attrShiftHi&mux != 0 {
+		pal |= 0x02
+	}
+	if px == 0 {
+		return 0, p.palette[0x00]
+	}
+	return px, p.palette[pal*4+px]
+}
+
+func (p *PPU) bgPatternAddr() uint16 {
+	var table uint16
+	if p.ctrlReg1&0x10 != 0x00 {
+		table = 0x1000
+	}
+	fineY := (p.v >> 12) & 0x07
+	return table + uint16(p.nextTile)*16 + fineY
+}
+
+func (p *PPU) fetchAttribute() {
+	addr := 0x23c0 | (p.v & 0x0c00) | ((p.v >> 4) & 0x38) | ((p.v >> 2) & 0x07)
+	attr := p.readVRAM(addr)
+	//32x32 ブロックの中の 16x16 の位置で2bitを選ぶ
+	shift := ((p.v >> 4) & 0x04) | (p.v & 0x02)
+	p.nextAttribute = (attr >> shift) & 0x03
+}
+
+func (p *PPU) shiftBG() {
+	p.patternShiftLo <<= 1
+	p.patternShiftHi <<= 1
+	p.attrShiftLo <<= 1
+	p.attrShiftHi <<= 1
+}
+
+//reloadBG は次のタイルをシフトレジスタの下位8bitに入れる
+func (p *PPU) reloadBG() {
+	p.patternShiftLo = (p.patternShiftLo & 0xff00) | uint16(p.nextPatternLow)
+	p.patternShiftHi = (p.patternShiftHi & 0xff00) | uint16(p.nextPatternHi)
+	p.attrShiftLo &= 0xff00
+	p.attrShiftHi &= 0xff00
+	if p.nextAttribute&0x01 != 0x00 {
+		p.attrShiftLo |= 0x00ff
+	}
+	if p.nextAttribute&0x02 != 0x00 {
+		p.attrShiftHi |= 0x00ff
+	}
+}
+
+//incrementX は coarse X を進め，はみ出したら隣のネームテーブルへ
+func (p *PPU) incrementX() {
+	if p.v&0x001f == 31 {
+		p.v &^= 0x001f
+		p.v ^= 0x0400
+	} else {
+		p.v++
+	}
+}
+
+//incrementY は fine Y を進め，タイル境界で coarse Y を進める
+func (p *PPU) incrementY() {
+	if p.v&0x7000 != 0x7000 {
+		p.v += 0x1000
+		return
+	}
+	p.v &^= 0x7000
+	y := (p.v & 0x03e0) >> 5
+	switch y {
+	case 29:
+		y = 0
+		p.v ^= 0x0800
+	case 31:
+		//属性テーブル領域からは折り返すだけ
+		y = 0
+	default:
+		y++
+	}
+	p.v = (p.v &^ 0x03e0) | (y << 5)
+}
+
+func (p *PPU) copyX() {
+	p.v = (p.v & 0xfbe0) | (p.t & 0x041f)
+}
+
+func (p *PPU) copyY() {
+	p.v = (p.v & 0x841f) | (p.t & 0x7be0)
+}
+
+func (p *PPU) spriteHeight() int {
+	if p.ctrlReg1&0x20 != 0x00 {
+		return 16
+	}
+	return 8
+}
+
+//renderSprites はスプライト評価(257)と 257-320 のパターン読み出しを行う．
+//MapperはこのアドレスバスのA12を見てスキャンラインを数える
+func (p *PPU) renderSprites() {
+	if p.cycle >= 257 && p.cycle <= 320 {
+		p.OAMAddr = 0
+	}
+	switch {
+	case p.cycle == 257:
+		if p.line < 240 {
+			p.evaluateSprites()
+		} else {
+			p.spriteCount = 0
+		}
+	case p.cycle > 257 && p.cycle <= 320:
+		slot := (p.cycle - 257) / 8
+		switch (p.cycle - 257) % 8 {
+		case 4:
+			p.spritePatternLo[slot] = p.readVRAM(p.spritePatternAddr(slot))
+		case 6:
+			p.spritePatternHi[slot] = p.readVRAM(p.spritePatternAddr(slot) + 8)
+			if slot < p.spriteCount && p.spriteAttr[slot]&0x40 != 0x00 {
+				p.spritePatternLo[slot] = reverseBits(p.spritePatternLo[slot])
+				p.spritePatternHi[slot] = reverseBits(p.spritePatternHi[slot])
+			}
+		}
+	}
+	if p.cycle == 260 {
+		p.mapper.Scanline()
+	}
+}
+
+//evaluateSprites は次のラインに掛かるスプライトを最大8個セカンダリOAMへ集める
+func (p *PPU) evaluateSprites() {
+	height := p.spriteHeight()
+	count := 0
+	n := 0
+	for ; n < 64 && count < 8; n++ {
+		y := int(p.OAM[n*4])
+		row := p.line - y
+		if row < 0 || row >= height {
+			continue
+		}
+		copy(p.secondaryOAM[count*4:count*4+4], p.OAM[n*4:n*4+4])
+		p.spriteIndex[count] = uint8(n)
+		p.spriteAttr[count] = p.OAM[n*4+2]
+		p.spriteX[count] = p.OAM[n*4+3]
+		count++
+	}
+	p.spriteCount = count
+
+	//8個見つけた後の探索は，外れるたびに n と一緒に m (スプライト内のバイト位置) も進んでしまう
+	//(ハードウェアのバグ)．Y以外のバイトを比べるので誤検出も見逃しも起きる
+	m := 0
+	for ; n < 64; n++ {
+		row := p.line - int(p.OAM[n*4+m])
+		if row >= 0 && row < height {
+			p.statusRegister |= 0x20
+			break
+		}
+		m = (m + 1) & 0x03
+	}
+}
+
+//spritePatternAddr はスロットのスプライトの今のラインのパターンアドレス．空きスロットはタイル$FF
+func (p *PPU) spritePatternAddr(slot int) uint16 {
+	tile := uint8(0xff)
+	row := 0
+	attr := uint8(0)
+	if slot < p.spriteCount {
+		tile = p.secondaryOAM[slot*4+1]
+		attr = p.spriteAttr[slot]
+		row = p.line - int(p.secondaryOAM[slot*4])
+	}
+	height := p.spriteHeight()
+	if attr&0x80 != 0x00 {
+		row = height - 1 - row
+	}
+	if height == 16 {
+		table := uint16(tile&0x01) * 0x1000
+		tile &= 0xfe
+		if row >= 8 {
+			tile++
+			row -= 8
+		}
+		return table + uint16(tile)*16 + uint16(row)
+	}
+	var table uint16
+	if p.ctrlReg1&0x08 != 0x00 {
+		table = 0x1000
+	}
+	return table + uint16(tile)*16 + uint16(row)
+}
+
+//spritePixel は x 座標で最優先の不透明スプライトを返す
+func (p *PPU) spritePixel(x int) (px uint8, color uint8, index int, isFront bool) {
+	if p.ctrlReg2&0x10 == 0x00 || (x < 8 && p.ctrlReg2&0x04 == 0x00) {
+		return 0, 0, -1, false
+	}
+	for i := 0; i < p.spriteCount; i++ {
+		offset := x - int(p.spriteX[i])
+		if offset < 0 || offset > 7 {
+			continue
+		}
+		bit := uint(7 - offset)
+		px := (p.spritePatternLo[i]>>bit)&0x01 | ((p.spritePatternHi[i]>>bit)&0x01)<<1
+		if px == 0 {
+			continue
+		}
+		attr := p.spriteAttr[i]
+		c := p.palette[0x10+int(attr&0x03)*4+int(px)]
+		return px, c, int(p.spriteIndex[i]), attr&0x20 == 0x00
+	}
+	return 0, 0, -1, false
+}
+
+func reverseBits(b uint8) uint8 {
+	var r uint8
+	for i := 0; i < 8; i++ {
+		r = r<<1 | b&0x01
+		b >>= 1
+	}
+	return r
+}
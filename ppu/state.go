@@ -0,0 +1,145 @@
+package ppu
+
+import "fmt"
+
+//State はセーブステートに書き出すPPUの状態
+type State struct {
+	//レジスタ・RAM
+	OAMAddr   uint8
+	OAM       [0x0100]uint8
+	NameTable [0x1000]uint8
+	Palette   [0x20]uint8
+	Status    uint8
+	Ctrl      uint8
+	Mask      uint8
+	ReadBuf   uint8
+	OpenBus   uint8
+	//loopy レジスタ
+	V, T uint16
+	X    uint8
+	W    bool
+	//BG パイプライン
+	NextTile       uint8
+	NextAttribute  uint8
+	NextPatternLow uint8
+	NextPatternHi  uint8
+	PatternShiftLo uint16
+	PatternShiftHi uint16
+	AttrShiftLo    uint16
+	AttrShiftHi    uint16
+	//スプライト
+	SpriteCount     int
+	SpriteIndex     [8]uint8
+	SpriteX         [8]uint8
+	SpriteAttr      [8]uint8
+	SpritePatternLo [8]uint8
+	SpritePatternHi [8]uint8
+	SecondaryOAM    [8 * 4]uint8
+	//画面．nil なら書き出さず，読むときは黒にする
+	Buffer *[ScreenWidth * ScreenHeight]uint8
+	Screen *[ScreenWidth * ScreenHeight]uint8
+	//タイミング
+	Cycle              int
+	Line               int
+	IsOddFrame         bool
+	IsVBlankSuppressed bool
+	FrameCount         int
+}
+
+//SaveState は現在の状態を返す
+func (p *PPU) SaveState() State {
+	buffer, screen := p.buffer, p.Screen
+	return State{
+		OAMAddr:            p.OAMAddr,
+		OAM:                p.OAM,
+		NameTable:          p.nameTable,
+		Palette:            p.palette,
+		Status:             p.statusRegister,
+		Ctrl:               p.ctrlReg1,
+		Mask:               p.ctrlReg2,
+		ReadBuf:            p.ppuBuffer,
+		OpenBus:            p.openBus,
+		V:                  p.v,
+		T:                  p.t,
+		X:                  p.x,
+		W:                  p.w,
+		NextTile:           p.nextTile,
+		NextAttribute:      p.nextAttribute,
+		NextPatternLow:     p.nextPatternLow,
+		NextPatternHi:      p.nextPatternHi,
+		PatternShiftLo:     p.patternShiftLo,
+		PatternShiftHi:     p.patternShiftHi,
+		AttrShiftLo:        p.attrShiftLo,
+		AttrShiftHi:        p.attrShiftHi,
+		SpriteCount:        p.spriteCount,
+		SpriteIndex:        p.spriteIndex,
+		SpriteX:            p.spriteX,
+		SpriteAttr:         p.spriteAttr,
+		SpritePatternLo:    p.spritePatternLo,
+		SpritePatternHi:    p.spritePatternHi,
+		SecondaryOAM:       p.secondaryOAM,
+		Buffer:             &buffer,
+		Screen:             &screen,
+		Cycle:              p.cycle,
+		Line:               p.line,
+		IsOddFrame:         p.isOddFrame,
+		IsVBlankSuppressed: p.isVBlankSuppressed,
+		FrameCount:         p.FrameCount,
+	}
+}
+
+//LoadState は SaveState で取った状態に戻す．範囲外の値があれば何も変えない
+func (p *PPU) LoadState(s State) error {
+	if s.Line < 0 || s.Line > 261 || s.Cycle < 0 || s.Cycle > 340 || s.SpriteCount < 0 || s.SpriteCount > 8 {
+		return fmt.Errorf("ppu: invalid state (line %d, dot %d, %d sprites)", s.Line, s.Cycle, s.SpriteCount)
+	}
+	for _, screen := range []*[ScreenWidth * ScreenHeight]uint8{s.Buffer, s.Screen} {
+		if screen == nil {
+			continue
+		}
+		for _, c := range screen {
+			if c > 0x3f {
+				return fmt.Errorf("ppu: invalid color in state")
+			}
+		}
+	}
+	p.OAMAddr = s.OAMAddr
+	p.OAM = s.OAM
+	p.nameTable = s.NameTable
+	p.palette = s.Palette
+	p.statusRegister = s.Status
+	p.ctrlReg1 = s.Ctrl
+	p.ctrlReg2 = s.Mask
+	p.ppuBuffer = s.ReadBuf
+	p.openBus = s.OpenBus
+	p.v, p.t, p.x, p.w = s.V, s.T, s.X, s.W
+	p.nextTile = s.NextTile
+	p.nextAttribute = s.NextAttribute
+	p.nextPatternLow = s.NextPatternLow
+	p.nextPatternHi = s.NextPatternHi
+	p.patternShiftLo = s.PatternShiftLo
+	p.patternShiftHi = s.PatternShiftHi
+	p.attrShiftLo = s.AttrShiftLo
+	p.attrShiftHi = s.AttrShiftHi
+	p.spriteCount = s.SpriteCount
+	p.spriteIndex = s.SpriteIndex
+	p.spriteX = s.SpriteX
+	p.spriteAttr = s.SpriteAttr
+	p.spritePatternLo = s.SpritePatternLo
+	p.spritePatternHi = s.SpritePatternHi
+	p.secondaryOAM = s.SecondaryOAM
+	p.buffer = [ScreenWidth * ScreenHeight]uint8{}
+	if s.Buffer != nil {
+		p.buffer = *s.Buffer
+	}
+	p.Screen = [ScreenWidth * ScreenHeight]uint8{}
+	if s.Screen != nil {
+		p.Screen = *s.Screen
+	}
+	p.cycle = s.Cycle
+	p.line = s.Line
+	p.isOddFrame = s.IsOddFrame
+	p.isVBlankSuppressed = s.IsVBlankSuppressed
+	p.FrameCount = s.FrameCount
+	return nil
+}